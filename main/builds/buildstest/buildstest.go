@@ -0,0 +1,29 @@
+// Package buildstest provides the test fixture of builds.Config
+package buildstest
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/log"
+	"os"
+	"path"
+	"testing"
+)
+
+// Setup write files into a temp dir which is used as DataDir, builds.Config is restored after the test
+func Setup(t testing.TB, files map[string]string) string {
+	t.Helper()
+	verbose := false
+	log.Verbose = &verbose
+	saved := builds.Config
+	t.Cleanup(func() {
+		builds.Config = saved
+	})
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builds.Config.XrayHelper.DataDir = dir
+	return dir
+}
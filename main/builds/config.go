@@ -25,6 +25,7 @@ var Config struct {
 		CPULimit      string   `default:"100" yaml:"cpuLimit"`
 		MemLimit      string   `default:"-1" yaml:"memLimit"`
 		ProxyTag      string   `default:"proxy" yaml:"proxyTag"`
+		ProxyTags     []string `yaml:"proxyTags"`
 		AllowInsecure bool     `default:"false" yaml:"allowInsecure"`
 		SubList       []string `yaml:"subList"`
 		UserAgent     string   `yaml:"userAgent"`
@@ -39,6 +40,45 @@ var Config struct {
 		WorkDir string `yaml:"workDir"`
 		DNSPort string `default:"65531" yaml:"dnsPort"`
 	} `yaml:"adgHome"`
+	Speedtest struct {
+		Url              string `default:"https://www.google.com/generate_204" yaml:"url"`
+		Status           int    `default:"204" yaml:"status"`
+		Timeout          int    `default:"3000" yaml:"timeout"`
+		Retries          int    `default:"0" yaml:"retries"`
+		RetryWindow      int    `default:"4000" yaml:"retryWindow"`
+		ListenWait       int    `default:"2000" yaml:"listenWait"`
+		DNS              string `default:"223.5.5.5" yaml:"dns"`
+		BatchSize        int    `default:"50" yaml:"batchSize"`
+		StartPort        int    `default:"65500" yaml:"startPort"`
+		DownloadUrl      string `default:"https://speed.cloudflare.com/__down?bytes=52428800" yaml:"downloadUrl"`
+		DownloadTime     int    `default:"10000" yaml:"downloadTime"`
+		DownloadSize     int    `default:"50" yaml:"downloadSize"`
+		DownloadParallel int    `default:"1" yaml:"downloadParallel"`
+		ExitIp           bool   `default:"false" yaml:"exitIp"`
+		IpUrl            string `default:"https://api.ipify.org" yaml:"ipUrl"`
+		UdpTarget        string `default:"8.8.8.8:53" yaml:"udpTarget"`
+		UdpDomain        string `default:"www.google.com" yaml:"udpDomain"`
+		TcpingParallel   int    `default:"32" yaml:"tcpingParallel"`
+		Prefilter        bool   `default:"false" yaml:"prefilter"`
+		Sort             bool   `default:"false" yaml:"sort"`
+		HideFailed       int    `default:"0" yaml:"hideFailed"`
+	} `yaml:"speedtest"`
+	Watchdog struct {
+		Interval   int      `default:"30" yaml:"interval"`
+		Failures   int      `default:"3" yaml:"failures"`
+		Timeout    int      `default:"5" yaml:"timeout"`
+		Custom     bool     `default:"false" yaml:"custom"`
+		Candidates []string `yaml:"candidates"`
+	} `yaml:"watchdog"`
+	Group struct {
+		Strategy  string `default:"leastPing" yaml:"strategy"`
+		Interval  string `default:"1m" yaml:"interval"`
+		Tolerance int    `default:"50" yaml:"tolerance"`
+	} `yaml:"group"`
+	Geodata struct {
+		ListDir string `yaml:"listDir"`
+		Merge   bool   `default:"false" yaml:"merge"`
+	} `yaml:"geodata"`
 	Proxy struct {
 		Method          string   `default:"tproxy" yaml:"method"`
 		TproxyPort      string   `default:"65535" yaml:"tproxyPort"`
@@ -69,6 +109,10 @@ func LoadConfig() error {
 	log.HandleDebug(Config.XrayHelper)
 	log.HandleDebug(Config.Clash)
 	log.HandleDebug(Config.AdgHome)
+	log.HandleDebug(Config.Speedtest)
+	log.HandleDebug(Config.Watchdog)
+	log.HandleDebug(Config.Group)
+	log.HandleDebug(Config.Geodata)
 	log.HandleDebug(Config.Proxy)
 	return nil
 }
@@ -4,14 +4,22 @@ import (
 	"XrayHelper/main/builds"
 	"XrayHelper/main/common"
 	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
 	"XrayHelper/main/routes"
 	"XrayHelper/main/serial"
 	"XrayHelper/main/shareurls"
+	"XrayHelper/main/shareurls/addon"
+	"XrayHelper/main/states"
 	"XrayHelper/main/switches"
+	"XrayHelper/main/switches/ray"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const tagApi = "api"
@@ -34,8 +42,20 @@ func (this *ApiCommand) Execute(args []string) error {
 	} else if len(args) < 2 {
 		return nil
 	}
-	api := API{Operation: args[0], Object: args[1], Addon: args[2:]}
-	response, err := json.Marshal(parse(&api))
+	api := API{Operation: args[0], Object: args[1]}
+	// dryRun previews the change of config as unified diff, instead of writing it
+	for _, addon := range args[2:] {
+		if addon == "dryRun" || addon == "dryRun=true" {
+			common.DryRun = true
+		} else {
+			api.Addon = append(api.Addon, addon)
+		}
+	}
+	result := parse(&api)
+	if common.DryRun {
+		result.Set("diff", common.DryRunDiff())
+	}
+	response, err := json.Marshal(result)
 	if err == nil {
 		fmt.Println(string(response))
 	} else {
@@ -61,11 +81,17 @@ func parse(api *API) (response *serial.OrderedMap) {
 			getDns(api, response)
 		case "dnsrule":
 			getDnsrule(api, response)
+		case "preset":
+			getPreset(api, response)
+		case "custom":
+			getCustom(api, response)
 		}
 	case "set":
 		switch api.Object {
 		case "switch":
 			setSwitch(api, response)
+		case "group":
+			setGroup(api, response)
 		case "rule":
 			setRule(api, response)
 		case "ruleset":
@@ -74,6 +100,10 @@ func parse(api *API) (response *serial.OrderedMap) {
 			setDns(api, response)
 		case "dnsrule":
 			setDnsrule(api, response)
+		case "preset":
+			setPreset(api, response)
+		case "custom":
+			setCustom(api, response)
 		}
 	case "add":
 		switch api.Object {
@@ -85,6 +115,10 @@ func parse(api *API) (response *serial.OrderedMap) {
 			addDns(api, response)
 		case "dnsrule":
 			addDnsrule(api, response)
+		case "preset":
+			addPreset(api, response)
+		case "custom":
+			addCustomNode(api, response)
 		}
 	case "exchange":
 		switch api.Object {
@@ -92,6 +126,8 @@ func parse(api *API) (response *serial.OrderedMap) {
 			exchangeRule(api, response)
 		case "dnsrule":
 			exchangeDnsrule(api, response)
+		case "custom":
+			exchangeCustomNode(api, response)
 		}
 	case "delete":
 		switch api.Object {
@@ -103,11 +139,23 @@ func parse(api *API) (response *serial.OrderedMap) {
 			deleteDns(api, response)
 		case "dnsrule":
 			deleteDnsrule(api, response)
+		case "preset":
+			deletePreset(api, response)
+		case "custom":
+			deleteCustomNode(api, response)
 		}
 	case "misc":
 		switch api.Object {
 		case "realping":
 			realPing(api, response)
+		case "autoswitch":
+			autoSwitch(api, response)
+		case "bandwidth":
+			bandwidth(api, response)
+		case "tcping":
+			tcping(api, response)
+		case "udp":
+			udp(api, response)
 		}
 	}
 	return
@@ -122,101 +170,515 @@ func getStatus(api *API, response *serial.OrderedMap) {
 }
 
 func getSwitch(api *API, response *serial.OrderedMap) {
-	get := func(custom bool) serial.OrderedArray {
-		var result serial.OrderedArray
+	var all bool
+	custom := false
+	for _, addon := range api.Addon {
+		if addon == "all" {
+			all = true
+		} else if addon == "custom" {
+			custom = true
+		} else if addon == "sort" {
+			builds.Config.Speedtest.Sort = true
+		} else if strings.HasPrefix(addon, "hideFailed=") {
+			builds.Config.Speedtest.HideFailed, _ = strconv.Atoi(strings.TrimPrefix(addon, "hideFailed="))
+		}
+	}
+	if err := states.LoadSpeedtest(); err != nil {
+		log.HandleDebug(err)
+	}
+	speedtest := new(serial.OrderedMap)
+	get := func(custom bool, key string) {
+		var (
+			result serial.OrderedArray
+			ids    []string
+		)
 		if s, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType); err == nil {
 			defer s.Clear()
 			for _, url := range s.Get(custom) {
 				result = append(result, url)
+				if info, ok := url.(*addon.NodeInfo); ok {
+					ids = append(ids, info.Id)
+					if latest := states.Latest(info.Id); latest != nil {
+						speedtest.Set(info.Id, latest)
+					}
+					if located := states.Located(info.Id); located != nil {
+						info.ExitIp, info.Country = located.ExitIp, located.Country
+					}
+				}
 			}
 		}
-		return result
-	}
-	if len(api.Addon) > 0 {
-		if api.Addon[0] == "all" {
-			response.Set("result", get(false))
-			response.Set("custom", get(true))
-		} else if api.Addon[0] == "custom" {
-			response.Set("result", get(true))
+		response.Set(key, result)
+		if len(ids) > 0 && (builds.Config.Speedtest.Sort || builds.Config.Speedtest.HideFailed > 0) {
+			response.Set(key+"Order", states.Order(ids, builds.Config.Speedtest.Sort, builds.Config.Speedtest.HideFailed))
 		}
+	}
+	if all {
+		get(false, "result")
+		get(true, "custom")
 	} else {
-		response.Set("result", get(false))
+		get(custom, "result")
+	}
+	response.Set("speedtest", *speedtest)
+	if err := states.LoadSwitch(); err == nil {
+		if states.Switch.Current != nil {
+			response.Set("current", states.Switch.Current)
+		}
+		if len(states.Switch.Tags) > 0 {
+			response.Set("tags", states.Switch.Tags)
+		}
+		if len(states.Switch.Group) > 0 {
+			response.Set("group", states.Switch.Group)
+		}
 	}
 }
 
 func setSwitch(api *API, response *serial.OrderedMap) {
 	response.Set("ok", false)
-	custom := false
-	index := 0
-	if len(api.Addon) == 2 && api.Addon[0] == "custom" {
-		custom = true
-		index, _ = strconv.Atoi(api.Addon[1])
-	} else if len(api.Addon) == 1 {
-		index, _ = strconv.Atoi(api.Addon[0])
-	} else {
+	var (
+		custom, viaCustom bool
+		index, via        = -1, -1
+		tag               string
+	)
+	for _, addon := range api.Addon {
+		if addon == "custom" {
+			custom = true
+		} else if strings.HasPrefix(addon, "tag=") {
+			tag = strings.TrimPrefix(addon, "tag=")
+		} else if addon == "viaCustom" {
+			viaCustom = true
+		} else if strings.HasPrefix(addon, "via=") {
+			var err error
+			if via, err = strconv.Atoi(strings.TrimPrefix(addon, "via=")); err != nil {
+				return
+			}
+		} else if i, err := strconv.Atoi(addon); err == nil && index < 0 {
+			index = i
+		} else {
+			return
+		}
+	}
+	if index < 0 {
 		return
 	}
 	if s, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType); err == nil {
-		if err := s.Set(custom, index); err == nil {
-			// if core is running, restart it
-			if len(getServicePid()) > 0 {
-				if err := restartService(); err == nil {
-					response.Set("ok", true)
-				}
-			} else {
-				response.Set("ok", true)
+		if len(tag) > 0 {
+			if err := s.Target(tag); err != nil {
+				response.Set("error", err.Error())
+				return
+			}
+		}
+		if via >= 0 {
+			err = s.Chain(custom, index, viaCustom, via)
+		} else {
+			err = s.Set(custom, index)
+		}
+		if err != nil {
+			response.Set("error", err.Error())
+		} else if err := restartAfterSwitch(s); err == nil {
+			response.Set("ok", true)
+		}
+	}
+}
+
+// setGroup put the nodes chosen by index, name=remarks or match=regex into group under proxy tag
+func setGroup(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	s, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType)
+	if err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	custom := false
+	var (
+		indexes []int
+		matches []func(name string) bool
+	)
+	for _, addon := range api.Addon {
+		if addon == "custom" {
+			custom = true
+		} else if strings.HasPrefix(addon, "name=") {
+			name := strings.TrimPrefix(addon, "name=")
+			matches = append(matches, func(remarks string) bool {
+				return remarks == name
+			})
+		} else if strings.HasPrefix(addon, "match=") {
+			re, err := regexp.Compile(strings.TrimPrefix(addon, "match="))
+			if err != nil {
+				response.Set("error", "invalid regular expression, "+err.Error())
+				return
+			}
+			matches = append(matches, re.MatchString)
+		} else if index, err := strconv.Atoi(addon); err == nil {
+			indexes = append(indexes, index)
+		} else {
+			response.Set("error", "invalid index "+addon)
+			return
+		}
+	}
+	for _, match := range matches {
+		indexes = append(indexes, s.Find(custom, match)...)
+	}
+	if err := s.Group(custom, indexes); err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	if err := restartAfterSwitch(s); err == nil {
+		response.Set("ok", true)
+	}
+}
+
+func autoSwitch(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	var (
+		custom     = false
+		match      func(name string) bool
+		maxLatency = 0
+		protocol   = ""
+	)
+	for _, addon := range api.Addon {
+		if addon == "custom" {
+			custom = true
+		} else if strings.HasPrefix(addon, "match=") {
+			re, err := regexp.Compile(strings.TrimPrefix(addon, "match="))
+			if err != nil {
+				response.Set("error", e.New("invalid regular expression "+strings.TrimPrefix(addon, "match=")+", ", err).WithPrefix(tagApi).Error())
+				return
 			}
+			match = re.MatchString
+		} else if strings.HasPrefix(addon, "maxLatency=") {
+			maxLatency, _ = strconv.Atoi(strings.TrimPrefix(addon, "maxLatency="))
+		} else if strings.HasPrefix(addon, "protocol=") {
+			protocol = strings.TrimPrefix(addon, "protocol=")
+		} else if err := setSpeedtestOption(addon); err != nil {
+			response.Set("error", err.Error())
+			return
 		}
 	}
+	s, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType)
+	if err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	result, err := autoChoose(s, custom, match, maxLatency, protocol)
+	if err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	index, _ := strconv.Atoi(result.Index)
+	if err := s.Set(custom, index); err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	response.Set("index", result.Index)
+	response.Set("remarks", result.Url.GetNodeInfo().Remarks)
+	response.Set("realping", result.Value)
+	response.Set("firstByte", result.FirstByte)
+	if err := restartAfterSwitch(s); err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	response.Set("ok", true)
+}
+
+// restartAfterSwitch if core is running, restart it, unless the node has been selected by core controller
+func restartAfterSwitch(s switches.Switch) error {
+	if common.DryRun || s.Live() || len(getServicePid()) == 0 {
+		return nil
+	}
+	return restartService()
 }
 
 func realPing(api *API, response *serial.OrderedMap) {
 	var responseArr serial.OrderedArray
 	response.Set("result", responseArr)
-	if len(api.Addon) == 0 {
+	custom, indexes, err := parseTestNodes(api.Addon)
+	if err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	for _, result := range realPingNodes(custom, indexes) {
+		var ret serial.OrderedMap
+		ret.Set("index", result.Index)
+		ret.Set("realping", result.Value)
+		ret.Set("firstByte", result.FirstByte)
+		if len(result.ExitIp) > 0 {
+			ret.Set("exitIp", result.ExitIp)
+			ret.Set("country", result.Country)
+		}
+		responseArr = append(responseArr, ret)
+	}
+	response.Set("result", responseArr)
+}
+
+func bandwidth(api *API, response *serial.OrderedMap) {
+	var responseArr serial.OrderedArray
+	response.Set("result", responseArr)
+	custom, indexes, err := parseTestNodes(api.Addon)
+	if err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	for _, result := range testNodes(custom, indexes, shareurls.Bandwidth) {
+		var ret serial.OrderedMap
+		ret.Set("index", result.Index)
+		ret.Set("mbps", math.Round(result.Mbps*100)/100)
+		responseArr = append(responseArr, ret)
+	}
+	response.Set("result", responseArr)
+}
+
+func udp(api *API, response *serial.OrderedMap) {
+	var responseArr serial.OrderedArray
+	response.Set("result", responseArr)
+	custom, indexes, err := parseTestNodes(api.Addon)
+	if err != nil {
+		response.Set("error", err.Error())
 		return
 	}
-	start := func(index []string, custom bool) (arr serial.OrderedArray) {
+	if len(indexes) == 0 {
+		return
+	}
+	for _, result := range testNodes(custom, indexes, shareurls.UdpTest) {
+		var ret serial.OrderedMap
+		ret.Set("index", result.Index)
+		ret.Set("udp", result.Udp >= 0)
+		ret.Set("rtt", result.Udp)
+		if result.Udp < 0 && len(result.Reason) > 0 {
+			ret.Set("reason", result.Reason)
+		}
+		responseArr = append(responseArr, ret)
+	}
+	response.Set("result", responseArr)
+}
+
+func tcping(api *API, response *serial.OrderedMap) {
+	var responseArr serial.OrderedArray
+	response.Set("result", responseArr)
+	custom, indexes, err := parseTestNodes(api.Addon)
+	if err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	for _, result := range tcpingNodes(custom, indexes) {
+		var ret serial.OrderedMap
+		ret.Set("index", result.Index)
+		ret.Set("tcp", result.Value)
+		ret.Set("tls", result.Total)
+		responseArr = append(responseArr, ret)
+	}
+	response.Set("result", responseArr)
+}
+
+// parseTestNodes parse speedtest addon args, [custom] [key=value] index...
+func parseTestNodes(addons []string) (custom bool, indexes []int, err error) {
+	for _, addon := range addons {
+		if addon == "custom" {
+			custom = true
+		} else if strings.Contains(addon, "=") {
+			if err = setSpeedtestOption(addon); err != nil {
+				return
+			}
+		} else {
+			id, _ := strconv.Atoi(addon)
+			indexes = append(indexes, id)
+		}
+	}
+	return
+}
+
+// setSpeedtestOption override the speedtest config by key=value for current api call
+func setSpeedtestOption(option string) error {
+	key, value, _ := strings.Cut(option, "=")
+	speedtest := &builds.Config.Speedtest
+	if key == "url" {
+		speedtest.Url = value
+		return nil
+	} else if key == "dns" {
+		speedtest.DNS = value
+		return nil
+	} else if key == "downloadUrl" {
+		speedtest.DownloadUrl = value
+		return nil
+	} else if key == "udpTarget" {
+		speedtest.UdpTarget = value
+		return nil
+	} else if key == "udpDomain" {
+		speedtest.UdpDomain = value
+		return nil
+	} else if key == "ipUrl" {
+		speedtest.IpUrl = value
+		return nil
+	} else if key == "prefilter" || key == "exitIp" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return e.New("invalid speedtest option "+option+", ", err).WithPrefix(tagApi)
+		}
+		if key == "prefilter" {
+			speedtest.Prefilter = enabled
+		} else {
+			speedtest.ExitIp = enabled
+		}
+		return nil
+	}
+	var target *int
+	switch key {
+	case "status":
+		target = &speedtest.Status
+	case "timeout":
+		target = &speedtest.Timeout
+	case "retries":
+		target = &speedtest.Retries
+	case "retryWindow":
+		target = &speedtest.RetryWindow
+	case "listenWait":
+		target = &speedtest.ListenWait
+	case "batchSize":
+		target = &speedtest.BatchSize
+	case "startPort":
+		target = &speedtest.StartPort
+	case "downloadTime":
+		target = &speedtest.DownloadTime
+	case "downloadSize":
+		target = &speedtest.DownloadSize
+	case "downloadParallel":
+		target = &speedtest.DownloadParallel
+	case "tcpingParallel":
+		target = &speedtest.TcpingParallel
+	default:
+		return e.New("unknown speedtest option " + key).WithPrefix(tagApi)
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return e.New("invalid speedtest option "+option+", ", err).WithPrefix(tagApi)
+	}
+	*target = number
+	return nil
+}
+
+// coreRealPing test the realping of results by core, replaced in tests
+var coreRealPing = shareurls.RealPing
+
+// realPingNodes test the realping of nodes in batches, and record them into speedtest history,
+// nodes failed the tcping are not tested by core if prefilter enabled, udp based nodes which cannot be tcpinged are tested by core directly
+func realPingNodes(custom bool, indexes []int) []*shareurls.Result {
+	var results, tested []*shareurls.Result
+	if builds.Config.Speedtest.Prefilter {
 		var (
-			results []*shareurls.Result
-			res     []*shareurls.Result
-			port    = 65500
-			i       = 0
+			passed []int
+			failed = make(map[string]*shareurls.Result)
 		)
-		if swh, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType); err == nil {
-			for _, idx := range index {
-				id, _ := strconv.Atoi(idx)
-				if target := swh.Choose(custom, id); target != nil {
-					if url, ok := target.(shareurls.ShareUrl); ok {
-						if i > 50 {
-							shareurls.RealPing(builds.Config.XrayHelper.CoreType, res)
-							results = append(results, res...)
-							res = make([]*shareurls.Result, 0)
-							port = 65500
-							i = 0
-						}
-						res = append(res, &shareurls.Result{Index: idx, Url: url, Port: port, Value: -1})
-						port -= 1
-						i++
-					}
-				}
+		for _, result := range tcpingNodes(custom, indexes) {
+			id, _ := strconv.Atoi(result.Index)
+			if !shareurls.CanTCPing(result.Url.GetNodeInfo()) || result.Value >= 0 && result.Total >= 0 {
+				passed = append(passed, id)
+			} else {
+				result.Value, result.Total = -1, -1
+				failed[result.Index] = result
 			}
 		}
-		shareurls.RealPing(builds.Config.XrayHelper.CoreType, res)
-		results = append(results, res...)
-		for _, result := range results {
-			var ret serial.OrderedMap
-			ret.Set("index", result.Index)
-			ret.Set("realping", result.Value)
-			arr = append(arr, ret)
+		tested = testNodes(custom, passed, coreRealPing)
+		testedMap := make(map[string]*shareurls.Result)
+		for _, result := range tested {
+			testedMap[result.Index] = result
+		}
+		for _, index := range indexes {
+			if result, ok := testedMap[strconv.Itoa(index)]; ok {
+				results = append(results, result)
+			} else if result, ok := failed[strconv.Itoa(index)]; ok {
+				results = append(results, result)
+			}
 		}
-		return
-	}
-	if api.Addon[0] == "custom" {
-		response.Set("result", start(api.Addon[1:], true))
 	} else {
-		response.Set("result", start(api.Addon, false))
+		results = testNodes(custom, indexes, coreRealPing)
+		tested = results
+	}
+	if err := states.LoadSpeedtest(); err != nil {
+		log.HandleDebug(err)
+	}
+	// the prefilter failures are not realping results, they are not recorded
+	now := time.Now().Unix()
+	for _, result := range tested {
+		states.AddRecord(result.Url.GetNodeInfo().Id, states.Record{Time: now, Realping: result.Value, ExitIp: result.ExitIp, Country: result.Country, Reason: result.Reason})
+	}
+	if err := states.SaveSpeedtest(); err != nil {
+		log.HandleDebug(err)
 	}
+	return results
+}
+
+// tcpingNodes test the tcp connect and tls handshake time of nodes without core
+func tcpingNodes(custom bool, indexes []int) []*shareurls.Result {
+	var results []*shareurls.Result
+	swh := new(ray.RaySwitch)
+	defer swh.Clear()
+	for _, id := range indexes {
+		if url, ok := swh.Choose(custom, id).(shareurls.ShareUrl); ok {
+			results = append(results, &shareurls.Result{Index: strconv.Itoa(id), Url: url, Value: -1, FirstByte: -1, Total: -1, Mbps: -1, Udp: -1})
+		}
+	}
+	shareurls.TCPing(results)
+	return results
+}
+
+// testNodes run the speedtest of nodes in batches
+func testNodes(custom bool, indexes []int, test func(coreType string, results []*shareurls.Result)) []*shareurls.Result {
+	var results []*shareurls.Result
+	// share link nodes can be tested by every core type, include mihomo
+	swh := new(ray.RaySwitch)
+	defer swh.Clear()
+	for _, id := range indexes {
+		if target := swh.Choose(custom, id); target != nil {
+			if url, ok := target.(shareurls.ShareUrl); ok {
+				results = append(results, &shareurls.Result{Index: strconv.Itoa(id), Url: url, Value: -1, FirstByte: -1, Total: -1, Mbps: -1, Udp: -1})
+			}
+		}
+	}
+	batchSize := builds.Config.Speedtest.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(results)
+	}
+	exclude := reservedPorts()
+	for start := 0; start < len(results); start += batchSize {
+		batch := results[start:min(start+batchSize, len(results))]
+		ports, err := common.FreeLocalPorts(builds.Config.Speedtest.StartPort, len(batch), exclude)
+		if err != nil {
+			log.HandleDebug(err)
+			for _, result := range batch {
+				result.Reason = err.Error()
+			}
+			continue
+		}
+		for i, result := range batch {
+			result.Port = ports[i]
+		}
+		test(builds.Config.XrayHelper.CoreType, batch)
+	}
+	return results
+}
+
+// reservedPorts the ports configured for xrayhelper, which cannot be used by test core
+func reservedPorts() map[int]bool {
+	reserved := make(map[int]bool)
+	for _, port := range []string{builds.Config.Proxy.TproxyPort, builds.Config.Proxy.SocksPort, builds.Config.Clash.DNSPort, builds.Config.AdgHome.DNSPort} {
+		if p, err := strconv.Atoi(port); err == nil {
+			reserved[p] = true
+		}
+	}
+	if _, port, err := net.SplitHostPort(builds.Config.AdgHome.Address); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			reserved[p] = true
+		}
+	}
+	return reserved
 }
 
 func getRule(api *API, response *serial.OrderedMap) {
@@ -232,9 +694,21 @@ func setRule(api *API, response *serial.OrderedMap) {
 				api.Addon[1] = decode
 			}
 			if err = json.Unmarshal([]byte(api.Addon[1]), &ruleMap); err == nil {
-				if routes.SetRule(index, &ruleMap) {
+				if routes.SetRule[serial.OrderedMap](index, &ruleMap) {
+					if err := routes.ApplyRule(); err == nil {
+						response.Set("ok", true)
+					} else {
+						response.Set("error", err.Error())
+					}
+				}
+			} else if coreType := builds.Config.XrayHelper.CoreType; coreType == "mihomo" || coreType == "hysteria2" {
+				// mihomo and hysteria2 rules are plain string
+				str := strings.Trim(api.Addon[1], "\"")
+				if routes.SetRule[string](index, &str) {
 					if err := routes.ApplyRule(); err == nil {
 						response.Set("ok", true)
+					} else {
+						response.Set("error", err.Error())
 					}
 				}
 			}
@@ -250,9 +724,21 @@ func addRule(api *API, response *serial.OrderedMap) {
 			api.Addon[0] = decode
 		}
 		if err := json.Unmarshal([]byte(api.Addon[0]), &ruleMap); err == nil {
-			if routes.AddRule(&ruleMap) {
+			if routes.AddRule[serial.OrderedMap](&ruleMap) {
+				if err := routes.ApplyRule(); err == nil {
+					response.Set("ok", true)
+				} else {
+					response.Set("error", err.Error())
+				}
+			}
+		} else if coreType := builds.Config.XrayHelper.CoreType; coreType == "mihomo" || coreType == "hysteria2" {
+			// mihomo and hysteria2 rules are plain string
+			str := strings.Trim(api.Addon[0], "\"")
+			if routes.AddRule[string](&str) {
 				if err := routes.ApplyRule(); err == nil {
 					response.Set("ok", true)
+				} else {
+					response.Set("error", err.Error())
 				}
 			}
 		}
@@ -267,6 +753,8 @@ func exchangeRule(api *API, response *serial.OrderedMap) {
 				if routes.ExchangeRule(a, b) {
 					if err := routes.ApplyRule(); err == nil {
 						response.Set("ok", true)
+					} else {
+						response.Set("error", err.Error())
 					}
 				}
 			}
@@ -281,6 +769,8 @@ func deleteRule(api *API, response *serial.OrderedMap) {
 			if routes.DeleteRule(index) {
 				if err := routes.ApplyRule(); err == nil {
 					response.Set("ok", true)
+				} else {
+					response.Set("error", err.Error())
 				}
 			}
 		}
@@ -340,6 +830,145 @@ func deleteRuleset(api *API, response *serial.OrderedMap) {
 	}
 }
 
+func getPreset(api *API, response *serial.OrderedMap) {
+	presets, err := routes.LoadPresets()
+	if err != nil {
+		log.HandleDebug(err)
+	}
+	if err := states.LoadPreset(); err != nil {
+		log.HandleDebug(err)
+	}
+	var result serial.OrderedArray
+	for _, preset := range presets {
+		var presetMap serial.OrderedMap
+		presetMap.Set("name", preset.Name)
+		presetMap.Set("version", preset.Version)
+		presetMap.Set("description", preset.Description)
+		// 0 means not applied
+		presetMap.Set("applied", states.Preset[preset.Name].Version)
+		result = append(result, presetMap)
+	}
+	response.Set("result", result)
+}
+
+// setPreset update the applied presets to the latest version
+func setPreset(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if _, err := updatePresets(api.Addon); err != nil {
+		response.Set("error", err.Error())
+		return
+	}
+	response.Set("ok", true)
+}
+
+// addPreset apply presets
+func addPreset(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if len(api.Addon) > 0 {
+		for _, name := range api.Addon {
+			if err := applyPreset(name); err != nil {
+				response.Set("error", err.Error())
+				return
+			}
+		}
+		response.Set("ok", true)
+	}
+}
+
+// deletePreset remove presets
+func deletePreset(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if len(api.Addon) > 0 {
+		for _, name := range api.Addon {
+			if err := routes.RemovePreset(name); err != nil {
+				response.Set("error", err.Error())
+				return
+			}
+		}
+		response.Set("ok", true)
+	}
+}
+
+// getCustom list the share links of custom nodes, with the node index, invalid links are not listed
+func getCustom(api *API, response *serial.OrderedMap) {
+	result := serial.OrderedArray{}
+	nodes, err := loadCustom()
+	if err != nil {
+		response.Set("error", err.Error())
+	} else {
+		for i, node := range nodes.urls {
+			var nodeMap serial.OrderedMap
+			nodeMap.Set("index", i)
+			nodeMap.Set("remarks", node.GetNodeInfo().Remarks)
+			nodeMap.Set("link", nodes.lines[nodes.position[i]])
+			result = append(result, nodeMap)
+		}
+	}
+	response.Set("result", result)
+}
+
+// setCustom set the remarks of custom node
+func setCustom(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if len(api.Addon) >= 2 {
+		if index, err := strconv.Atoi(api.Addon[0]); err == nil {
+			if err := renameCustom(index, strings.Join(api.Addon[1:], " ")); err != nil {
+				response.Set("error", err.Error())
+				return
+			}
+			response.Set("ok", true)
+		}
+	}
+}
+
+// addCustomNode add custom node by share link, which can be base64 encoded
+func addCustomNode(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if len(api.Addon) == 1 {
+		link := api.Addon[0]
+		if _, err := shareurls.Parse(link); err != nil {
+			if decode, err := common.DecodeBase64(link); err == nil {
+				link = decode
+			}
+		}
+		index, err := addCustom(link)
+		if err != nil {
+			response.Set("error", err.Error())
+			return
+		}
+		response.Set("index", index)
+		response.Set("ok", true)
+	}
+}
+
+func exchangeCustomNode(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if len(api.Addon) == 2 {
+		if a, err := strconv.Atoi(api.Addon[0]); err == nil {
+			if b, err := strconv.Atoi(api.Addon[1]); err == nil {
+				if err := exchangeCustom(a, b); err != nil {
+					response.Set("error", err.Error())
+					return
+				}
+				response.Set("ok", true)
+			}
+		}
+	}
+}
+
+func deleteCustomNode(api *API, response *serial.OrderedMap) {
+	response.Set("ok", false)
+	if len(api.Addon) == 1 {
+		if index, err := strconv.Atoi(api.Addon[0]); err == nil {
+			if err := deleteCustom(index); err != nil {
+				response.Set("error", err.Error())
+				return
+			}
+			response.Set("ok", true)
+		}
+	}
+}
+
 func getDns(api *API, response *serial.OrderedMap) {
 	response.Set("result", routes.GetDns())
 }
@@ -423,6 +1052,8 @@ func setDnsrule(api *API, response *serial.OrderedMap) {
 				if routes.SetDnsrule(index, &ruleMap) {
 					if err := routes.ApplyDnsrule(); err == nil {
 						response.Set("ok", true)
+					} else {
+						response.Set("error", err.Error())
 					}
 				}
 			}
@@ -441,6 +1072,8 @@ func addDnsrule(api *API, response *serial.OrderedMap) {
 			if routes.AddDnsrule(&ruleMap) {
 				if err := routes.ApplyDnsrule(); err == nil {
 					response.Set("ok", true)
+				} else {
+					response.Set("error", err.Error())
 				}
 			}
 		}
@@ -455,6 +1088,8 @@ func exchangeDnsrule(api *API, response *serial.OrderedMap) {
 				if routes.ExchangeDnsrule(a, b) {
 					if err := routes.ApplyDnsrule(); err == nil {
 						response.Set("ok", true)
+					} else {
+						response.Set("error", err.Error())
 					}
 				}
 			}
@@ -469,6 +1104,8 @@ func deleteDnsrule(api *API, response *serial.OrderedMap) {
 			if routes.DeleteDnsrule(index) {
 				if err := routes.ApplyDnsrule(); err == nil {
 					response.Set("ok", true)
+				} else {
+					response.Set("error", err.Error())
 				}
 			}
 		}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/shareurls"
+	"XrayHelper/main/states"
+	"net"
+	"testing"
+)
+
+func TestRealPingPrefilter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	_ = closed.Close()
+	buildstest.Setup(t, map[string]string{
+		"custom.txt": "socks://" + listener.Addr().String() + "#open\nsocks://" + closed.Addr().String() + "#closed\nhysteria2://auth@127.0.0.1:443#udp\n",
+	})
+	builds.Config.Speedtest.Prefilter = true
+	builds.Config.Speedtest.Timeout = 1000
+	builds.Config.Speedtest.TcpingParallel = 1
+	builds.Config.Speedtest.StartPort = 60000
+	saved := coreRealPing
+	t.Cleanup(func() {
+		coreRealPing = saved
+	})
+	var tested []string
+	coreRealPing = func(coreType string, results []*shareurls.Result) {
+		for _, result := range results {
+			tested = append(tested, result.Url.GetNodeInfo().Remarks)
+			result.Value = 50
+		}
+	}
+	results := realPingNodes(true, []int{0, 1, 2})
+	if len(results) != 3 || results[0].Value != 50 || results[1].Value != -1 || results[2].Value != 50 {
+		t.Fatalf("unexpected results %+v %+v %+v", *results[0], *results[1], *results[2])
+	}
+	if len(tested) != 2 || tested[0] != "open" || tested[1] != "udp" {
+		t.Errorf("expect open and udp nodes tested by core, got %v", tested)
+	}
+	if err := states.LoadSpeedtest(); err != nil {
+		t.Fatal(err)
+	}
+	if len(states.Speedtest) != 2 || states.Latest(results[1].Url.GetNodeInfo().Id) != nil {
+		t.Errorf("prefilter failure should not be recorded, got %+v", states.Speedtest)
+	}
+}
@@ -0,0 +1,368 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"XrayHelper/main/shareurls"
+	"XrayHelper/main/states"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	tagCustom    = "custom"
+	customPrefix = "xrayhelpercustom-"
+)
+
+type CustomCommand struct{}
+
+func (this *CustomCommand) Execute(args []string) error {
+	if err := builds.LoadConfig(); err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		nodes, err := loadCustom()
+		if err != nil {
+			return err
+		}
+		for i, node := range nodes.urls {
+			fmt.Println(color.GreenString("[%d]", i) + " " + node.GetNodeInfoStr())
+		}
+		return nil
+	}
+	var err error
+	switch args[0] {
+	case "add":
+		if len(args) != 2 {
+			return e.New("not specify share link").WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		var index int
+		if index, err = addCustom(args[1]); err == nil {
+			log.HandleInfo("custom: add node " + strconv.Itoa(index))
+		}
+	case "rename":
+		if len(args) < 3 {
+			return e.New("not specify index and remarks").WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		index, atoiErr := strconv.Atoi(args[1])
+		if atoiErr != nil {
+			return e.New("invalid index " + args[1]).WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		if err = renameCustom(index, strings.Join(args[2:], " ")); err == nil {
+			log.HandleInfo("custom: rename node " + args[1])
+		}
+	case "exchange":
+		if len(args) != 3 {
+			return e.New("not specify the indexes to exchange").WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		a, errA := strconv.Atoi(args[1])
+		b, errB := strconv.Atoi(args[2])
+		if errA != nil || errB != nil {
+			return e.New("invalid index " + args[1] + " or " + args[2]).WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		if err = exchangeCustom(a, b); err == nil {
+			log.HandleInfo("custom: exchange node " + args[1] + " and " + args[2])
+		}
+	case "delete":
+		if len(args) != 2 {
+			return e.New("not specify index").WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		index, atoiErr := strconv.Atoi(args[1])
+		if atoiErr != nil {
+			return e.New("invalid index " + args[1]).WithPrefix(tagCustom).WithPathObj(*this)
+		}
+		if err = deleteCustom(index); err == nil {
+			log.HandleInfo("custom: delete node " + args[1])
+		}
+	default:
+		return e.New("unknown operation " + args[0] + ", available operation [list|add|rename|exchange|delete]").WithPrefix(tagCustom).WithPathObj(*this)
+	}
+	return err
+}
+
+// customNodes the lines of custom.txt, invalid links are kept as they are, but not counted in node index
+type customNodes struct {
+	lines []string
+	urls  []shareurls.ShareUrl
+	// line of each node index
+	position []int
+}
+
+// customTxt get the path of custom.txt
+func customTxt() string {
+	return path.Join(builds.Config.XrayHelper.DataDir, "custom.txt")
+}
+
+// loadCustom load custom.txt, a nonexistent file means no custom node
+func loadCustom() (*customNodes, error) {
+	nodes := new(customNodes)
+	content, err := common.ReadConfFile(customTxt())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nodes, nil
+		}
+		return nil, e.New("read custom.txt failed, ", err).WithPrefix(tagCustom)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if shareUrl, err := shareurls.Parse(line); err == nil {
+			nodes.urls = append(nodes.urls, shareUrl)
+			nodes.position = append(nodes.position, len(nodes.lines))
+		}
+		nodes.lines = append(nodes.lines, line)
+	}
+	return nodes, nil
+}
+
+// save write custom.txt
+func (this *customNodes) save() error {
+	var content string
+	if len(this.lines) > 0 {
+		content = strings.Join(this.lines, "\n") + "\n"
+	}
+	if err := common.WriteConfFile(customTxt(), []byte(content)); err != nil {
+		return e.New("write custom.txt failed, ", err).WithPrefix(tagCustom)
+	}
+	return nil
+}
+
+// check make sure index is a valid node index
+func (this *customNodes) check(index int) error {
+	if index < 0 || index >= len(this.urls) {
+		return e.New("custom node index " + strconv.Itoa(index) + " out of range").WithPrefix(tagCustom)
+	}
+	return nil
+}
+
+// addCustom validate the share link and append it to custom.txt, return the node index
+func addCustom(link string) (int, error) {
+	link = strings.TrimSpace(link)
+	shareUrl, err := shareurls.Parse(link)
+	if err != nil {
+		return -1, e.New("invalid share link, ", err).WithPrefix(tagCustom)
+	}
+	nodes, err := loadCustom()
+	if err != nil {
+		return -1, err
+	}
+	id := shareUrl.GetNodeInfo().Id
+	for i, node := range nodes.urls {
+		if node.GetNodeInfo().Id == id {
+			return -1, e.New("node already exists as custom node " + strconv.Itoa(i)).WithPrefix(tagCustom)
+		}
+	}
+	nodes.lines = append(nodes.lines, link)
+	if err := nodes.save(); err != nil {
+		return -1, err
+	}
+	return len(nodes.urls), nil
+}
+
+// renameCustom change the remarks of custom node, the node id is not changed
+func renameCustom(index int, remarks string) error {
+	nodes, err := loadCustom()
+	if err != nil {
+		return err
+	}
+	if err := nodes.check(index); err != nil {
+		return err
+	}
+	link, err := setRemarks(nodes.lines[nodes.position[index]], remarks)
+	if err != nil {
+		return err
+	}
+	shareUrl, err := shareurls.Parse(link)
+	if err != nil || shareUrl.GetNodeInfo().Remarks != remarks {
+		return e.New("cannot set remarks " + remarks + " of custom node " + strconv.Itoa(index)).WithPrefix(tagCustom)
+	}
+	nodes.lines[nodes.position[index]] = link
+	return nodes.save()
+}
+
+// setRemarks set the remarks of share link, it is the ps field of vmess json, or the url fragment of others
+func setRemarks(link string, remarks string) (string, error) {
+	if strings.HasPrefix(link, "vmess://") {
+		if decode, err := common.DecodeBase64(strings.TrimPrefix(link, "vmess://")); err == nil {
+			var vmessMap serial.OrderedMap
+			if err := json.Unmarshal([]byte(decode), &vmessMap); err != nil {
+				return "", e.New("unmarshal vmess json failed, ", err).WithPrefix(tagCustom)
+			}
+			vmessMap.Set("ps", remarks)
+			marshal, err := json.Marshal(vmessMap)
+			if err != nil {
+				return "", e.New("marshal vmess json failed, ", err).WithPrefix(tagCustom)
+			}
+			return "vmess://" + base64.StdEncoding.EncodeToString(marshal), nil
+		}
+	}
+	link, _, _ = strings.Cut(link, "#")
+	return link + "#" + url.PathEscape(remarks), nil
+}
+
+// exchangeCustom exchange the order of two custom nodes
+func exchangeCustom(a int, b int) error {
+	nodes, err := loadCustom()
+	if err != nil {
+		return err
+	}
+	if err := nodes.check(a); err != nil {
+		return err
+	}
+	if err := nodes.check(b); err != nil {
+		return err
+	}
+	if a == b {
+		return nil
+	}
+	original := append([]string(nil), nodes.lines...)
+	lineA, lineB := nodes.position[a], nodes.position[b]
+	nodes.lines[lineA], nodes.lines[lineB] = nodes.lines[lineB], nodes.lines[lineA]
+	return nodes.reorder(original, map[int]int{a: b, b: a})
+}
+
+// customReferences get the indexes of xrayhelpercustom-<index> tags referenced by rules and sing-box selectors
+func customReferences() (map[int]bool, error) {
+	tags, err := routes.ReferencedTags()
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[int]bool)
+	for _, tag := range tags {
+		if index, err := strconv.Atoi(strings.TrimPrefix(tag, customPrefix)); err == nil && strings.HasPrefix(tag, customPrefix) {
+			indexes[index] = true
+		}
+	}
+	return indexes, nil
+}
+
+// deleteCustom delete custom node, the node referenced by routes cannot be deleted
+func deleteCustom(index int) error {
+	nodes, err := loadCustom()
+	if err != nil {
+		return err
+	}
+	if err := nodes.check(index); err != nil {
+		return err
+	}
+	if err := states.LoadSwitch(); err != nil {
+		return err
+	}
+	for tag, node := range states.Switch.Routes {
+		if node.Custom && node.Index == index {
+			return e.New("custom node " + strconv.Itoa(index) + " is referenced by routes as " + tag + ", remove the rules first").WithPrefix(tagCustom)
+		}
+	}
+	referenced, err := customReferences()
+	if err != nil {
+		return err
+	}
+	if referenced[index] {
+		return e.New("custom node " + strconv.Itoa(index) + " is referenced by routes as " + customPrefix + strconv.Itoa(index) + ", remove the rules first").WithPrefix(tagCustom)
+	}
+	original := append([]string(nil), nodes.lines...)
+	line := nodes.position[index]
+	nodes.lines = append(nodes.lines[:line], nodes.lines[line+1:]...)
+	moved := map[int]int{index: -1}
+	for i := index + 1; i < len(nodes.urls); i++ {
+		moved[i] = i - 1
+	}
+	return nodes.reorder(original, moved)
+}
+
+// reorder save the reordered custom.txt and move the node indexes, the original custom.txt is restored if they cannot be moved
+func (this *customNodes) reorder(original []string, moved map[int]int) error {
+	if err := this.save(); err != nil {
+		return err
+	}
+	if err := reindexCustom(moved); err != nil {
+		this.lines = original
+		if err := this.save(); err != nil {
+			log.HandleDebug(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// reindexCustom replace the xrayhelpercustom-<index> tags referenced by rules first, then move the custom node indexes saved in switch state,
+// the deleted node has new index -1, custom.txt should be reordered already, nothing is moved if the rules cannot be rewritten
+func reindexCustom(moved map[int]int) error {
+	if err := states.LoadSwitch(); err != nil {
+		return err
+	}
+	// the rules may reference custom nodes which are not recorded in switch state
+	referenced, err := customReferences()
+	if err != nil {
+		return err
+	}
+	for tag, node := range states.Switch.Routes {
+		if node.Custom && strings.HasPrefix(tag, customPrefix) {
+			referenced[node.Index] = true
+		}
+	}
+	replace := make(map[string]string)
+	for index := range referenced {
+		if newIndex, ok := moved[index]; ok && newIndex >= 0 {
+			replace[customPrefix+strconv.Itoa(index)] = customPrefix + strconv.Itoa(newIndex)
+		}
+	}
+	// the routed nodes are saved into switch state again when rules applied
+	if len(replace) > 0 {
+		if err := routes.ReplaceOutboundTag(replace); err != nil {
+			return err
+		}
+		if err := states.LoadSwitch(); err != nil {
+			return err
+		}
+	}
+	// fix return false if the node is deleted
+	var fix func(node *states.Node) bool
+	fix = func(node *states.Node) bool {
+		if node.Via != nil && !fix(node.Via) {
+			node.Via = nil
+		}
+		if !node.Custom {
+			return true
+		}
+		if index, ok := moved[node.Index]; ok {
+			if index < 0 {
+				return false
+			}
+			node.Index = index
+		}
+		return true
+	}
+	if states.Switch.Current != nil && !fix(states.Switch.Current) {
+		states.Switch.Current = nil
+	}
+	for tag, node := range states.Switch.Tags {
+		if fix(&node) {
+			states.Switch.Tags[tag] = node
+		} else {
+			delete(states.Switch.Tags, tag)
+		}
+	}
+	var group []states.Node
+	for _, node := range states.Switch.Group {
+		if fix(&node) {
+			group = append(group, node)
+		}
+	}
+	states.Switch.Group = group
+	return states.SaveSwitch()
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/common"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"XrayHelper/main/states"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const customFixture = "trojan://pass@1.1.1.1:443#A\ntrojan://pass@2.2.2.2:443#B\ntrojan://pass@3.3.3.3:443#C\n"
+
+// setupCustom use a xray config whose rules reference custom nodes, but switch.json only records the current node
+func setupCustom(t *testing.T) string {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.json": `{"outbounds":[{"protocol":"freedom","tag":"proxy"},{"protocol":"freedom","tag":"direct"}],"routing":{"rules":[{"domain":["a.com"],"outboundTag":"xrayhelpercustom-0"},{"domain":["c.com"],"outboundTag":"xrayhelpercustom-2"}]}}`,
+		"custom.txt":  customFixture,
+		"switch.json": `{"current":{"id":"a","custom":true,"index":0}}`,
+	})
+	builds.Config.XrayHelper.CoreType = "xray"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	builds.Config.XrayHelper.ProxyTag = "proxy"
+	routes.ClearRule()
+	t.Cleanup(routes.ClearRule)
+	return dir
+}
+
+// ruleTags get the outbound tags of rules in core config
+func ruleTags() string {
+	routes.ClearRule()
+	var outbounds []string
+	for _, r := range routes.GetRule() {
+		ruleMap := r.(serial.OrderedMap)
+		tag, _ := ruleMap.Get("outboundTag")
+		outbounds = append(outbounds, serial.ToString(tag.Value))
+	}
+	return strings.Join(outbounds, ",")
+}
+
+func TestSetRemarks(t *testing.T) {
+	buildstest.Setup(t, nil)
+	vmess := "vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"v":"2","ps":"old","add":"1.1.1.1","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811"}`))
+	link, err := setRemarks(vmess, "new name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode, err := common.DecodeBase64(strings.TrimPrefix(link, "vmess://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vmessMap map[string]string
+	if err := json.Unmarshal([]byte(decode), &vmessMap); err != nil {
+		t.Fatal(err)
+	}
+	if vmessMap["ps"] != "new name" || vmessMap["add"] != "1.1.1.1" {
+		t.Errorf("unexpected vmess json %v", vmessMap)
+	}
+	if link, _ := setRemarks("trojan://pass@1.1.1.1:443#old", "new name"); link != "trojan://pass@1.1.1.1:443#new%20name" {
+		t.Errorf("unexpected link %s", link)
+	}
+	if link, _ := setRemarks("trojan://pass@1.1.1.1:443", "new"); link != "trojan://pass@1.1.1.1:443#new" {
+		t.Errorf("unexpected link %s", link)
+	}
+}
+
+func TestExchangeCustom(t *testing.T) {
+	dir := setupCustom(t)
+	if err := exchangeCustom(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path.Join(dir, "custom.txt"))
+	if string(content) != "trojan://pass@3.3.3.3:443#C\ntrojan://pass@2.2.2.2:443#B\ntrojan://pass@1.1.1.1:443#A\n" {
+		t.Errorf("unexpected custom.txt:\n%s", content)
+	}
+	// the rules still route to the same nodes
+	if tags := ruleTags(); tags != "xrayhelpercustom-2,xrayhelpercustom-0" {
+		t.Errorf("expect rules route to xrayhelpercustom-2,xrayhelpercustom-0, got %s", tags)
+	}
+	if err := states.LoadSwitch(); err != nil {
+		t.Fatal(err)
+	}
+	if states.Switch.Current == nil || states.Switch.Current.Index != 2 {
+		t.Errorf("expect current node index 2, got %+v", states.Switch.Current)
+	}
+	if node := states.Switch.Routes["xrayhelpercustom-2"]; node.Index != 2 {
+		t.Errorf("unexpected routes %+v", states.Switch.Routes)
+	}
+}
+
+func TestDeleteCustom(t *testing.T) {
+	dir := setupCustom(t)
+	if err := deleteCustom(2); err == nil {
+		t.Error("expect error for the node referenced by rules")
+	}
+	if err := deleteCustom(1); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path.Join(dir, "custom.txt"))
+	if string(content) != "trojan://pass@1.1.1.1:443#A\ntrojan://pass@3.3.3.3:443#C\n" {
+		t.Errorf("unexpected custom.txt:\n%s", content)
+	}
+	if tags := ruleTags(); tags != "xrayhelpercustom-0,xrayhelpercustom-1" {
+		t.Errorf("expect rules route to xrayhelpercustom-0,xrayhelpercustom-1, got %s", tags)
+	}
+	if err := states.LoadSwitch(); err != nil {
+		t.Fatal(err)
+	}
+	if states.Switch.Current == nil || states.Switch.Current.Index != 0 {
+		t.Errorf("expect current node index 0, got %+v", states.Switch.Current)
+	}
+	if node := states.Switch.Routes["xrayhelpercustom-1"]; node.Index != 1 {
+		t.Errorf("unexpected routes %+v", states.Switch.Routes)
+	}
+	result, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	if strings.Contains(string(result), "2.2.2.2") || !strings.Contains(string(result), "3.3.3.3") {
+		t.Errorf("expect A and C routed:\n%s", result)
+	}
+
+	// the member of sing-box selector is referenced as well
+	buildstest.Setup(t, map[string]string{
+		"config.json": `{"outbounds":[{"type":"selector","tag":"proxy","outbounds":["xrayhelpercustom-1"]},{"type":"direct","tag":"direct"}],"route":{"rules":[{"domain":["a.com"],"outbound":"direct"}]}}`,
+		"custom.txt":  customFixture,
+	})
+	builds.Config.XrayHelper.CoreType = "sing-box"
+	builds.Config.XrayHelper.CoreConfig = path.Join(builds.Config.XrayHelper.DataDir, "config.json")
+	routes.ClearRule()
+	if err := deleteCustom(1); err == nil {
+		t.Error("expect error for the node referenced by selector")
+	}
+}
+
+func TestExchangeCustomRollback(t *testing.T) {
+	dir := setupCustom(t)
+	// the rule to a missing outbound cannot be applied, so the tags cannot be rewritten
+	config := `{"outbounds":[{"protocol":"freedom","tag":"proxy"}],"routing":{"rules":[{"domain":["a.com"],"outboundTag":"xrayhelpercustom-0"},{"domain":["b.com"],"outboundTag":"missing"}]}}`
+	if err := os.WriteFile(builds.Config.XrayHelper.CoreConfig, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := exchangeCustom(0, 2); err == nil {
+		t.Fatal("expect error when rules cannot be rewritten")
+	}
+	content, _ := os.ReadFile(path.Join(dir, "custom.txt"))
+	if string(content) != customFixture {
+		t.Errorf("expect custom.txt restored:\n%s", content)
+	}
+	if result, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig); string(result) != config {
+		t.Errorf("expect core config unchanged:\n%s", result)
+	}
+	if result, _ := os.ReadFile(path.Join(dir, "switch.json")); string(result) != `{"current":{"id":"a","custom":true,"index":0}}` {
+		t.Errorf("expect switch.json unchanged:\n%s", result)
+	}
+}
@@ -0,0 +1,363 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/geodata"
+	"XrayHelper/main/log"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"net/netip"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const tagGeo = "geo"
+
+type GeoCommand struct {
+	Binary bool `long:"binary" description:"compile the exported rule-set to binary .srs by sing-box core"`
+	Merge  bool `long:"merge" description:"merge the built categories into geoip.dat and geosite.dat"`
+}
+
+func (this *GeoCommand) Execute(args []string) error {
+	if err := builds.LoadConfig(); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return e.New("not specify operation, available operation [list|show|match|export|build]").WithPrefix(tagGeo).WithPathObj(*this)
+	}
+	if args[0] == "export" {
+		return exportGeo(args[1:], this.Binary)
+	}
+	if args[0] == "build" {
+		if len(args) > 2 {
+			return e.New("too many arguments").WithPrefix(tagGeo).WithPathObj(*this)
+		}
+		if len(args) == 2 {
+			builds.Config.Geodata.ListDir = args[1]
+		}
+		return buildGeo(this.Merge || builds.Config.Geodata.Merge)
+	}
+	if len(args) > 2 {
+		return e.New("too many arguments").WithPrefix(tagGeo).WithPathObj(*this)
+	}
+	var target string
+	if len(args) == 2 {
+		target = args[1]
+	}
+	switch args[0] {
+	case "list":
+		return listGeo(target)
+	case "show":
+		return showGeo(target)
+	case "match":
+		return matchGeo(target)
+	default:
+		return e.New("unknown operation " + args[0] + ", available operation [list|show|match|export|build]").WithPrefix(tagGeo).WithPathObj(*this)
+	}
+}
+
+func geoipFile() string {
+	return path.Join(builds.Config.XrayHelper.DataDir, "geoip.dat")
+}
+
+func geositeFile() string {
+	return path.Join(builds.Config.XrayHelper.DataDir, "geosite.dat")
+}
+
+// listGeo print the categories and entry count of geoip.dat or geosite.dat, both if not specified
+func listGeo(kind string) error {
+	if kind != "" && kind != "geoip" && kind != "geosite" {
+		return e.New("unknown geodata " + kind + ", available geodata [geoip|geosite]").WithPrefix(tagGeo)
+	}
+	if kind == "" || kind == "geosite" {
+		list, err := geodata.LoadGeoSite(geositeFile())
+		if err != nil {
+			return err
+		}
+		for _, geosite := range list {
+			fmt.Println(color.GreenString("geosite:"+strings.ToLower(geosite.CountryCode)) + " " + strconv.Itoa(len(geosite.Domain)))
+		}
+	}
+	if kind == "" || kind == "geoip" {
+		list, err := geodata.LoadGeoIP(geoipFile())
+		if err != nil {
+			return err
+		}
+		for _, geoip := range list {
+			fmt.Println(color.GreenString("geoip:"+strings.ToLower(geoip.CountryCode)) + " " + strconv.Itoa(len(geoip.Cidr)))
+		}
+	}
+	return nil
+}
+
+// showGeo print the entries of category, like geosite:google, geosite:google@cn or geoip:cn
+func showGeo(category string) error {
+	kind, code, _ := strings.Cut(category, ":")
+	if len(code) == 0 {
+		return e.New("not specify category, like geosite:google, geosite:google@cn or geoip:cn").WithPrefix(tagGeo)
+	}
+	switch kind {
+	case "geosite":
+		code, attr, _ := strings.Cut(code, "@")
+		list, err := geodata.LoadGeoSite(geositeFile())
+		if err != nil {
+			return err
+		}
+		geosite := geodata.FindGeoSite(list, code)
+		if geosite == nil {
+			return e.New("cannot find category " + category).WithPrefix(tagGeo)
+		}
+		for _, domain := range geosite.Domain {
+			if len(attr) == 0 || domain.HasAttribute(attr) {
+				fmt.Println(domain.String())
+			}
+		}
+	case "geoip":
+		list, err := geodata.LoadGeoIP(geoipFile())
+		if err != nil {
+			return err
+		}
+		geoip := geodata.FindGeoIP(list, code)
+		if geoip == nil {
+			return e.New("cannot find category " + category).WithPrefix(tagGeo)
+		}
+		if geoip.ReverseMatch {
+			fmt.Println(color.YellowString("(reverse match)"))
+		}
+		for _, cidr := range geoip.Cidr {
+			fmt.Println(cidr.String())
+		}
+	default:
+		return e.New("unknown geodata " + kind + ", available geodata [geoip|geosite]").WithPrefix(tagGeo)
+	}
+	return nil
+}
+
+// matchGeo print the geoip categories which contain the ip, or the geosite categories which contain the domain
+func matchGeo(target string) error {
+	if len(target) == 0 {
+		return e.New("not specify domain or ip").WithPrefix(tagGeo)
+	}
+	var codes []string
+	if ip, err := netip.ParseAddr(target); err == nil {
+		list, err := geodata.LoadGeoIP(geoipFile())
+		if err != nil {
+			return err
+		}
+		for _, code := range geodata.MatchIP(list, ip) {
+			codes = append(codes, "geoip:"+strings.ToLower(code))
+		}
+	} else {
+		list, err := geodata.LoadGeoSite(geositeFile())
+		if err != nil {
+			return err
+		}
+		for _, code := range geodata.MatchDomain(list, target) {
+			codes = append(codes, "geosite:"+strings.ToLower(code))
+		}
+	}
+	if len(codes) == 0 {
+		return e.New("no category contains " + target).WithPrefix(tagGeo)
+	}
+	for _, code := range codes {
+		fmt.Println(color.GreenString(code))
+	}
+	return nil
+}
+
+// exportGeo convert the categories to sing-box rule-set source in ${DataDir}/ruleset, and register them into sing-box config
+func exportGeo(categories []string, binary bool) error {
+	if len(categories) == 0 {
+		return e.New("not specify category, like geosite:google, geosite:google@cn or geoip:cn").WithPrefix(tagGeo)
+	}
+	if binary && builds.Config.XrayHelper.CoreType != "sing-box" {
+		return e.New("compile binary rule-set need sing-box core").WithPrefix(tagGeo)
+	}
+	paths, err := exportRuleset(categories, binary)
+	if err != nil {
+		return err
+	}
+	for i, category := range categories {
+		log.HandleInfo("geo: export " + category + " to " + paths[i])
+	}
+	if builds.Config.XrayHelper.CoreType != "sing-box" {
+		log.HandleInfo("geo: core type is not sing-box, skip registering rule-set")
+		return nil
+	}
+	for _, p := range paths {
+		log.HandleInfo("geo: register rule-set " + strings.TrimSuffix(path.Base(p), path.Ext(p)) + ", reference it by rule_set in route rules")
+	}
+	return nil
+}
+
+// exportRuleset write the rule-set of categories, and register them when core type is sing-box, return the rule-set paths,
+// nothing is written or compiled in dry run, the rule-set files are shown in the diff instead
+func exportRuleset(categories []string, binary bool) ([]string, error) {
+	rulesetDir := path.Join(builds.Config.XrayHelper.DataDir, "ruleset")
+	if !common.DryRun {
+		if err := os.MkdirAll(rulesetDir, 0755); err != nil {
+			return nil, e.New("create ruleset dir failed, ", err).WithPrefix(tagGeo)
+		}
+	}
+	var (
+		geoipList   []*geodata.GeoIP
+		geositeList []*geodata.GeoSite
+		tags        []string
+		paths       []string
+		exported    = make(map[string]*serial.OrderedMap)
+	)
+	for _, category := range categories {
+		kind, code, _ := strings.Cut(category, ":")
+		code, attr, _ := strings.Cut(code, "@")
+		var source serial.OrderedMap
+		switch kind {
+		case "geosite":
+			if geositeList == nil {
+				var err error
+				if geositeList, err = geodata.LoadGeoSite(geositeFile()); err != nil {
+					return nil, err
+				}
+			}
+			geosite := geodata.FindGeoSite(geositeList, code)
+			if geosite == nil {
+				return nil, e.New("cannot find category " + category).WithPrefix(tagGeo)
+			}
+			source = geodata.GeoSiteRuleset(geosite, attr)
+		case "geoip":
+			if geoipList == nil {
+				var err error
+				if geoipList, err = geodata.LoadGeoIP(geoipFile()); err != nil {
+					return nil, err
+				}
+			}
+			geoip := geodata.FindGeoIP(geoipList, code)
+			if geoip == nil {
+				return nil, e.New("cannot find category " + category).WithPrefix(tagGeo)
+			}
+			source = geodata.GeoIPRuleset(geoip)
+		default:
+			return nil, e.New("unknown geodata " + kind + ", available geodata [geoip|geosite]").WithPrefix(tagGeo)
+		}
+		tag := kind + "-" + strings.ToLower(code)
+		if len(attr) > 0 {
+			tag += "@" + strings.ToLower(attr)
+		}
+		marshal, err := json.MarshalIndent(source, "", "    ")
+		if err != nil {
+			return nil, e.New("marshal rule-set "+tag+" failed, ", err).WithPrefix(tagGeo)
+		}
+		sourcePath := path.Join(rulesetDir, tag+".json")
+		if err := common.WriteConfFile(sourcePath, marshal); err != nil {
+			return nil, e.New("write rule-set "+tag+" failed, ", err).WithPrefix(tagGeo)
+		}
+		format, rulesetPath := "source", sourcePath
+		if binary {
+			format, rulesetPath = "binary", path.Join(rulesetDir, tag+".srs")
+			if common.DryRun {
+				// the binary rule-set cannot be compiled from a pending source, only show where it goes
+				if err := common.WriteConfFile(rulesetPath, []byte("compiled from "+sourcePath+"\n")); err != nil {
+					return nil, e.New("write rule-set "+tag+" failed, ", err).WithPrefix(tagGeo)
+				}
+			} else {
+				var errMsg bytes.Buffer
+				compile := common.NewExternal(0, nil, &errMsg, builds.Config.XrayHelper.CorePath, "rule-set", "compile", "--output", rulesetPath, sourcePath)
+				compile.Run()
+				if err := compile.Err(); err != nil {
+					return nil, e.New("compile rule-set "+tag+" failed, ", err, " ", errMsg.String()).WithPrefix(tagGeo)
+				}
+			}
+		}
+		paths = append(paths, rulesetPath)
+		var ruleset serial.OrderedMap
+		ruleset.Set("tag", tag)
+		ruleset.Set("type", "local")
+		ruleset.Set("format", format)
+		ruleset.Set("path", rulesetPath)
+		exported[tag] = &ruleset
+		tags = append(tags, tag)
+	}
+	if builds.Config.XrayHelper.CoreType != "sing-box" {
+		return paths, nil
+	}
+	for _, tag := range tags {
+		index := -1
+		for i, r := range routes.GetRuleset() {
+			if rMap, ok := r.(serial.OrderedMap); ok {
+				if t, ok := rMap.Get("tag"); ok && serial.ToString(t.Value) == tag {
+					index = i
+					break
+				}
+			}
+		}
+		if index >= 0 {
+			routes.SetRuleset(index, exported[tag])
+		} else {
+			routes.AddRuleset(exported[tag])
+		}
+	}
+	return paths, routes.ApplyRuleset()
+}
+
+// geoListDir the dir of custom plain-text lists, default is ${DataDir}/geolist
+func geoListDir() string {
+	if len(builds.Config.Geodata.ListDir) > 0 {
+		return builds.Config.Geodata.ListDir
+	}
+	return path.Join(builds.Config.XrayHelper.DataDir, "geolist")
+}
+
+// buildGeo compile the custom lists into geosite_custom.dat and geoip_custom.dat, and merge them into geosite.dat and geoip.dat if needed
+func buildGeo(merge bool) error {
+	geositeList, geoipList, err := geodata.BuildDir(geoListDir())
+	if err != nil {
+		return err
+	}
+	write := func(file string, data []byte) error {
+		if err := os.WriteFile(path.Join(builds.Config.XrayHelper.DataDir, file), data, 0644); err != nil {
+			return e.New("write "+file+" failed, ", err).WithPrefix(tagGeo)
+		}
+		log.HandleInfo("geo: build " + file)
+		return nil
+	}
+	if err := write("geosite_custom.dat", geodata.MarshalGeoSite(geositeList)); err != nil {
+		return err
+	}
+	if err := write("geoip_custom.dat", geodata.MarshalGeoIP(geoipList)); err != nil {
+		return err
+	}
+	if !merge {
+		return nil
+	}
+	// the base file is optional, but a broken one should not be overwritten
+	var baseGeosite, baseGeoip []byte
+	if _, err := os.Stat(geositeFile()); err == nil {
+		if baseGeosite, err = os.ReadFile(geositeFile()); err != nil {
+			return e.New("read geosite file failed, ", err).WithPrefix(tagGeo)
+		}
+	}
+	if _, err := os.Stat(geoipFile()); err == nil {
+		if baseGeoip, err = os.ReadFile(geoipFile()); err != nil {
+			return e.New("read geoip file failed, ", err).WithPrefix(tagGeo)
+		}
+	}
+	geosite, err := geodata.MergeGeoSite(baseGeosite, geositeList)
+	if err != nil {
+		return err
+	}
+	geoip, err := geodata.MergeGeoIP(baseGeoip, geoipList)
+	if err != nil {
+		return err
+	}
+	if err := write("geosite.dat", geosite); err != nil {
+		return err
+	}
+	return write("geoip.dat", geoip)
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/common"
+	"XrayHelper/main/geodata"
+	"XrayHelper/main/routes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestExportRulesetDryRun(t *testing.T) {
+	geosite := geodata.MarshalGeoSite([]*geodata.GeoSite{{CountryCode: "CN", Domain: []geodata.Domain{{Type: geodata.RootDomain, Value: "cn"}}}})
+	dir := buildstest.Setup(t, map[string]string{
+		"geosite.dat": string(geosite),
+		"config.json": `{"outbounds":[{"type":"direct","tag":"direct"}],"route":{"rules":[]}}`,
+	})
+	builds.Config.XrayHelper.CoreType = "sing-box"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	// the core is not called in dry run
+	builds.Config.XrayHelper.CorePath = path.Join(dir, "sing-box")
+	common.DryRun = true
+	t.Cleanup(func() { common.DryRun = false })
+	routes.ClearRule()
+	t.Cleanup(routes.ClearRule)
+	paths, err := exportRuleset([]string{"geosite:cn"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != path.Join(dir, "ruleset", "geosite-cn.srs") {
+		t.Errorf("unexpected paths %v", paths)
+	}
+	if _, err := os.Stat(path.Join(dir, "ruleset")); !os.IsNotExist(err) {
+		t.Errorf("expect ruleset dir not created in dry run, got %v", err)
+	}
+	diff := common.DryRunDiff()
+	for _, want := range []string{"ruleset/geosite-cn.json", "ruleset/geosite-cn.srs", `"geosite-cn"`} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expect %s in diff:\n%s", want, diff)
+		}
+	}
+}
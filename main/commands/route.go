@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/states"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"net/netip"
+	"sort"
+	"strconv"
+)
+
+const tagRoute = "route"
+
+type RouteCommand struct {
+	Test   RouteTestCommand   `command:"test" description:"simulate which rule and outbound the connection will match"`
+	Preset RoutePresetCommand `command:"preset" description:"list, apply, update or remove preset rule bundles"`
+}
+
+type RouteTestCommand struct {
+	Port    int    `short:"p" long:"port" description:"the destination port"`
+	Network string `short:"n" long:"network" default:"tcp" description:"the network, tcp or udp"`
+	Inbound string `short:"i" long:"inbound" description:"the inbound tag"`
+	IP      string `long:"ip" description:"the resolved ip of domain, to test ip rules as well"`
+}
+
+func (this *RouteTestCommand) Execute(args []string) error {
+	if err := builds.LoadConfig(); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return e.New("not specify domain or ip").WithPrefix(tagRoute).WithPathObj(*this)
+	}
+	if len(args) > 1 {
+		return e.New("too many arguments").WithPrefix(tagRoute).WithPathObj(*this)
+	}
+	target := &routes.Target{Port: this.Port, Network: this.Network, Inbound: this.Inbound}
+	if ip, err := netip.ParseAddr(args[0]); err == nil {
+		target.IP = ip
+	} else {
+		target.Domain = args[0]
+		if len(this.IP) > 0 {
+			if target.IP, err = netip.ParseAddr(this.IP); err != nil {
+				return e.New("invalid ip "+this.IP+", ", err).WithPrefix(tagRoute).WithPathObj(*this)
+			}
+		}
+	}
+	decision, err := routes.SimulateRoute(target)
+	if err != nil {
+		return err
+	}
+	var skipped []int
+	for index := range decision.Skipped {
+		if decision.Index < 0 || index < decision.Index {
+			skipped = append(skipped, index)
+		}
+	}
+	sort.Ints(skipped)
+	for _, index := range skipped {
+		fmt.Println(color.YellowString("[%d] skipped, %s", index, decision.Skipped[index]))
+	}
+	if decision.Index < 0 {
+		fmt.Println("no rule matched, use default outbound " + color.CyanString(decision.Outbound))
+		return nil
+	}
+	marshal, _ := json.Marshal(decision.Rule)
+	fmt.Println(color.GreenString("[%d]", decision.Index) + " " + string(marshal))
+	fmt.Println("matched by " + decision.Reason + ", outbound " + color.CyanString(decision.Outbound))
+	return nil
+}
+
+type RoutePresetCommand struct{}
+
+func (this *RoutePresetCommand) Execute(args []string) error {
+	if err := builds.LoadConfig(); err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		return listPresets()
+	}
+	switch args[0] {
+	case "apply", "remove":
+		if len(args) == 1 {
+			return e.New("not specify preset name").WithPrefix(tagRoute).WithPathObj(*this)
+		}
+		for _, name := range args[1:] {
+			var err error
+			if args[0] == "apply" {
+				err = applyPreset(name)
+			} else {
+				err = routes.RemovePreset(name)
+			}
+			if err != nil {
+				return err
+			}
+			log.HandleInfo("route: " + args[0] + " preset " + name)
+		}
+		return nil
+	case "update":
+		updated, err := updatePresets(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(updated) == 0 {
+			log.HandleInfo("route: all applied presets are up to date")
+		}
+		for _, name := range updated {
+			log.HandleInfo("route: update preset " + name)
+		}
+		return nil
+	default:
+		return e.New("unknown operation " + args[0] + ", available operation [list|apply|update|remove]").WithPrefix(tagRoute).WithPathObj(*this)
+	}
+}
+
+// listPresets print all presets with their applied version
+func listPresets() error {
+	presets, err := routes.LoadPresets()
+	if err != nil {
+		return err
+	}
+	if err := states.LoadPreset(); err != nil {
+		return err
+	}
+	for _, preset := range presets {
+		line := color.GreenString(preset.Name) + " v" + strconv.Itoa(preset.Version) + " " + preset.Description
+		if applied, ok := states.Preset[preset.Name]; ok {
+			if applied.Version == preset.Version {
+				line += color.CyanString(" (applied)")
+			} else {
+				line += color.YellowString(" (applied v%d, update available)", applied.Version)
+			}
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// applyPreset translate preset for current core type and apply it, the geodata categories are exported as rule-set for sing-box
+func applyPreset(name string) error {
+	presets, err := routes.LoadPresets()
+	if err != nil {
+		return err
+	}
+	preset := routes.FindPreset(presets, name)
+	if preset == nil {
+		return e.New("cannot find preset " + name).WithPrefix(tagRoute)
+	}
+	outbounds, err := routes.PresetOutbounds()
+	if err != nil {
+		return err
+	}
+	rules, categories, err := routes.TranslatePreset(builds.Config.XrayHelper.CoreType, preset, outbounds)
+	if err != nil {
+		return err
+	}
+	if len(categories) > 0 {
+		var unique []string
+		exported := make(map[string]bool)
+		for _, category := range categories {
+			if !exported[category] {
+				exported[category] = true
+				unique = append(unique, category)
+			}
+		}
+		if _, err := exportRuleset(unique, false); err != nil {
+			return err
+		}
+	}
+	return routes.ApplyPreset(preset.Name, preset.Version, rules)
+}
+
+// updatePresets re-apply the applied presets whose version changed, or the specified presets, return the updated presets
+func updatePresets(names []string) ([]string, error) {
+	if err := states.LoadPreset(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		presets, err := routes.LoadPresets()
+		if err != nil {
+			return nil, err
+		}
+		for _, preset := range presets {
+			if applied, ok := states.Preset[preset.Name]; ok && applied.Version != preset.Version {
+				names = append(names, preset.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		if _, ok := states.Preset[name]; !ok {
+			return nil, e.New("preset " + name + " is not applied").WithPrefix(tagRoute)
+		}
+		if err := applyPreset(name); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
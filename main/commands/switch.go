@@ -2,28 +2,143 @@ package commands
 
 import (
 	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
 	"XrayHelper/main/log"
+	"XrayHelper/main/shareurls"
 	"XrayHelper/main/switches"
+	"XrayHelper/main/switches/ray"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-type SwitchCommand struct{}
+const tagSwitch = "switch"
+
+type SwitchCommand struct {
+	Custom bool   `long:"custom" description:"choose node from custom nodes"`
+	Tag    string `long:"tag" description:"switch the outbound (proxy group for mihomo) of the tag in proxyTags instead of proxyTag"`
+	Index  int    `long:"index" default:"-1" description:"choose node by index, non-interactive"`
+	Name   string `long:"name" description:"choose node by remarks, non-interactive"`
+	Match  string `long:"match" description:"choose node whose remarks match the regular expression, non-interactive"`
+
+	Via       int  `long:"via" default:"-1" description:"dial the chosen node through the node of index, proxy chain"`
+	ViaCustom bool `long:"via-custom" description:"choose the relay node of --via from custom nodes"`
+
+	MaxLatency int    `long:"max-latency" description:"ignore nodes whose realping exceeds the value (ms), for auto switch"`
+	Protocol   string `long:"protocol" description:"only choose nodes with the protocol (eg: vless, trojan), for auto switch"`
+
+	Prefilter  bool `long:"prefilter" description:"skip nodes which failed the tcp/tls handshake ping before realping, for auto switch"`
+	Sort       bool `long:"sort" description:"sort the node list by the latest realping"`
+	HideFailed int  `long:"hide-failed" description:"hide nodes which failed the last N realping tests"`
+	DryRun     bool `long:"dry-run" description:"print the change of core config as unified diff instead of writing it"`
+}
 
 func (this *SwitchCommand) Execute(args []string) error {
 	if err := builds.LoadConfig(); err != nil {
 		return err
 	}
+	if this.Prefilter {
+		builds.Config.Speedtest.Prefilter = true
+	}
+	if this.Sort {
+		builds.Config.Speedtest.Sort = true
+	}
+	if this.HideFailed > 0 {
+		builds.Config.Speedtest.HideFailed = this.HideFailed
+	}
+	common.DryRun = this.DryRun
 	switcher, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType)
 	if err != nil {
 		return err
 	}
-	success, err := switcher.Execute(args)
-	if err != nil {
-		return err
+	if len(this.Tag) > 0 {
+		if err := switcher.Target(this.Tag); err != nil {
+			return err
+		}
 	}
-	if success {
+	var success bool
+	if len(args) > 0 && args[0] == "auto" {
+		if len(args) > 2 || (len(args) == 2 && args[1] != "custom") {
+			return e.New("too many arguments").WithPrefix(tagSwitch).WithPathObj(*this)
+		}
+		if this.Index >= 0 || len(this.Name) > 0 || this.Via >= 0 {
+			return e.New("--index, --name and --via cannot be used for auto switch").WithPrefix(tagSwitch).WithPathObj(*this)
+		}
+		custom := this.Custom || len(args) == 2
+		var match func(name string) bool
+		if len(this.Match) > 0 {
+			re, err := regexp.Compile(this.Match)
+			if err != nil {
+				return e.New("invalid regular expression "+this.Match+", ", err).WithPrefix(tagSwitch).WithPathObj(*this)
+			}
+			match = re.MatchString
+		}
+		log.HandleInfo("switch: testing realping of candidate nodes")
+		result, err := autoChoose(switcher, custom, match, this.MaxLatency, this.Protocol)
+		if err != nil {
+			return err
+		}
+		log.HandleInfo("switch: choose node [" + result.Index + "] " + result.Url.GetNodeInfo().Remarks + ", realping " + strconv.Itoa(result.Value) + "ms")
+		index, _ := strconv.Atoi(result.Index)
+		if err := switcher.Set(custom, index); err != nil {
+			return err
+		}
+		success = true
+	} else if len(args) > 0 && args[0] == "group" {
+		if this.Via >= 0 {
+			return e.New("--via cannot be used for group").WithPrefix(tagSwitch).WithPathObj(*this)
+		}
+		custom, indexes, err := this.chooseGroup(switcher, args[1:])
+		if err != nil {
+			return err
+		}
+		if err := switcher.Group(custom, indexes); err != nil {
+			return err
+		}
+		success = true
+	} else if this.Index >= 0 || len(this.Name) > 0 || len(this.Match) > 0 {
+		if len(args) > 1 || (len(args) == 1 && args[0] != "custom") {
+			return e.New("too many arguments").WithPrefix(tagSwitch).WithPathObj(*this)
+		}
+		custom := this.Custom || len(args) == 1
+		// the chain of mihomo is made of share link nodes, rather than clash subscribes
+		nodes := switcher
+		if this.Via >= 0 && builds.Config.XrayHelper.CoreType == "mihomo" {
+			nodes = new(ray.RaySwitch)
+		}
+		index, err := this.choose(nodes, custom)
+		if err != nil {
+			return err
+		}
+		if this.Via >= 0 {
+			err = switcher.Chain(custom, index, this.ViaCustom, this.Via)
+		} else {
+			err = switcher.Set(custom, index)
+		}
+		if err != nil {
+			return err
+		}
+		success = true
+	} else if this.Via >= 0 {
+		return e.New("--via should be used with --index, --name or --match").WithPrefix(tagSwitch).WithPathObj(*this)
+	} else {
+		if this.Custom && len(args) == 0 && builds.Config.XrayHelper.CoreType != "mihomo" {
+			args = append(args, "custom")
+		}
+		if success, err = switcher.Execute(args); err != nil {
+			return err
+		}
+	}
+	if success && this.DryRun {
+		fmt.Print(common.DryRunDiff())
+	} else if success {
 		log.HandleInfo("switch: switch success")
-		// if core is running, restart it
-		if len(getServicePid()) > 0 {
+		// if core is running, restart it, unless the node has been selected by core controller
+		if switcher.Live() {
+			log.HandleInfo("switch: node has been selected by core controller, no need to restart")
+		} else if len(getServicePid()) > 0 {
 			log.HandleInfo("switch: detect core is running, restart it")
 			if err := restartService(); err != nil {
 				log.HandleError("restart service failed, " + err.Error())
@@ -34,3 +149,126 @@ func (this *SwitchCommand) Execute(args []string) error {
 	}
 	return nil
 }
+
+// choose get the node index by index, name or match option
+func (this *SwitchCommand) choose(switcher switches.Switch, custom bool) (int, error) {
+	options := 0
+	for _, specified := range []bool{this.Index >= 0, len(this.Name) > 0, len(this.Match) > 0} {
+		if specified {
+			options++
+		}
+	}
+	if options > 1 {
+		return -1, e.New("only one of --index, --name and --match can be specified").WithPrefix(tagSwitch)
+	}
+	if this.Index >= 0 {
+		if switcher.Choose(custom, this.Index) == nil {
+			return -1, e.New("cannot find node with index " + strconv.Itoa(this.Index)).WithPrefix(tagSwitch)
+		}
+		return this.Index, nil
+	}
+	var (
+		match   func(name string) bool
+		pattern string
+	)
+	if len(this.Name) > 0 {
+		pattern = "name " + this.Name
+		match = func(name string) bool {
+			return name == this.Name
+		}
+	} else {
+		pattern = "regular expression " + this.Match
+		re, err := regexp.Compile(this.Match)
+		if err != nil {
+			return -1, e.New("invalid regular expression "+this.Match+", ", err).WithPrefix(tagSwitch)
+		}
+		match = re.MatchString
+	}
+	indexes := switcher.Find(custom, match)
+	switch len(indexes) {
+	case 0:
+		return -1, e.New("cannot find any node matches " + pattern).WithPrefix(tagSwitch)
+	case 1:
+		return indexes[0], nil
+	default:
+		var candidates []string
+		for _, index := range indexes {
+			candidates = append(candidates, strconv.Itoa(index))
+		}
+		return -1, e.New("multiple nodes match "+pattern+", candidate indexes [", strings.Join(candidates, ", "), "]").WithPrefix(tagSwitch)
+	}
+}
+
+// chooseGroup get the node indexes of group by index arguments, index, name and match options
+func (this *SwitchCommand) chooseGroup(switcher switches.Switch, args []string) (bool, []int, error) {
+	custom := this.Custom
+	var indexes []int
+	for _, arg := range args {
+		if arg == "custom" {
+			custom = true
+			continue
+		}
+		index, err := strconv.Atoi(arg)
+		if err != nil {
+			return false, nil, e.New("invalid index " + arg).WithPrefix(tagSwitch)
+		}
+		indexes = append(indexes, index)
+	}
+	if this.Index >= 0 {
+		indexes = append(indexes, this.Index)
+	}
+	if len(this.Name) > 0 {
+		indexes = append(indexes, switcher.Find(custom, func(name string) bool {
+			return name == this.Name
+		})...)
+	}
+	if len(this.Match) > 0 {
+		re, err := regexp.Compile(this.Match)
+		if err != nil {
+			return false, nil, e.New("invalid regular expression "+this.Match+", ", err).WithPrefix(tagSwitch)
+		}
+		indexes = append(indexes, switcher.Find(custom, re.MatchString)...)
+	}
+	if len(indexes) == 0 {
+		return false, nil, e.New("no node is chosen for group").WithPrefix(tagSwitch)
+	}
+	return custom, indexes, nil
+}
+
+// autoChoose test realping of the candidate nodes, and choose the fastest one
+func autoChoose(switcher switches.Switch, custom bool, match func(name string) bool, maxLatency int, protocol string) (*shareurls.Result, error) {
+	// mihomo switches clash subscribes, which are not share link nodes
+	if builds.Config.XrayHelper.CoreType == "mihomo" {
+		return nil, e.New("auto switch is not supported by mihomo").WithPrefix(tagSwitch)
+	}
+	if match == nil {
+		match = func(string) bool {
+			return true
+		}
+	}
+	var candidates []int
+	for _, index := range switcher.Find(custom, match) {
+		if url, ok := switcher.Choose(custom, index).(shareurls.ShareUrl); ok {
+			if len(protocol) == 0 || strings.EqualFold(url.GetNodeInfo().Type, protocol) {
+				candidates = append(candidates, index)
+			}
+		}
+	}
+	switcher.Clear()
+	if len(candidates) == 0 {
+		return nil, e.New("cannot find any candidate node").WithPrefix(tagSwitch)
+	}
+	var best *shareurls.Result
+	for _, result := range realPingNodes(custom, candidates) {
+		if result.Value < 0 || (maxLatency > 0 && result.Value > maxLatency) {
+			continue
+		}
+		if best == nil || result.Value < best.Value {
+			best = result
+		}
+	}
+	if best == nil {
+		return nil, e.New("no available node in " + strconv.Itoa(len(candidates)) + " candidate nodes").WithPrefix(tagSwitch)
+	}
+	return best, nil
+}
@@ -5,7 +5,11 @@ import (
 	"XrayHelper/main/common"
 	e "XrayHelper/main/errors"
 	"XrayHelper/main/log"
+	"XrayHelper/main/routes"
 	"XrayHelper/main/serial"
+	"XrayHelper/main/shareurls/addon"
+	"XrayHelper/main/states"
+	"XrayHelper/main/switches"
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
@@ -466,6 +470,13 @@ func updateGeodata() error {
 	if err := common.DownloadFile(path.Join(builds.Config.XrayHelper.DataDir, "geosite.dat"), geositeDownloadUrl); err != nil {
 		return err
 	}
+	// merge custom lists into the downloaded geodata
+	if builds.Config.Geodata.Merge {
+		if _, err := os.Stat(geoListDir()); err == nil {
+			return buildGeo(true)
+		}
+		log.HandleInfo("update: geodata list dir " + geoListDir() + " not exist, skip merging")
+	}
 	return nil
 }
 
@@ -502,6 +513,9 @@ func updateSubscribe() error {
 		if err := os.WriteFile(path.Join(builds.Config.XrayHelper.DataDir, "sub.txt"), []byte(builder.String()), 0644); err != nil {
 			return e.New("write subscribe file failed, ", err).WithPrefix(tagUpdate)
 		}
+		if err := resolveNodes(); err != nil {
+			log.HandleError(err)
+		}
 	}
 	// update clash subscribe
 	for index, subUrl := range clashUrl {
@@ -525,6 +539,102 @@ func updateSubscribe() error {
 	return nil
 }
 
+// resolveNodes re-resolve the persisted nodes by id after subscribe refreshed, keep the same server selected and routed
+func resolveNodes() error {
+	switch builds.Config.XrayHelper.CoreType {
+	case "xray", "sing-box", "hysteria2":
+	default:
+		return nil
+	}
+	if err := states.LoadSwitch(); err != nil {
+		return err
+	}
+	s, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType)
+	if err != nil {
+		return err
+	}
+	indexes := make(map[string]int)
+	for index, node := range s.Get(false) {
+		if nodeInfo, ok := node.(*addon.NodeInfo); ok {
+			if _, ok := indexes[nodeInfo.Id]; !ok {
+				indexes[nodeInfo.Id] = index
+			}
+		}
+	}
+	s.Clear()
+	resolve := func(node *states.Node, name string) {
+		if node.Custom {
+			return
+		}
+		if index, ok := indexes[node.Id]; ok {
+			if index != node.Index {
+				log.HandleInfo("update: " + name + " moved from index " + strconv.Itoa(node.Index) + " to " + strconv.Itoa(index))
+				node.Index = index
+			}
+		} else {
+			log.HandleInfo("update: " + name + " is no longer in subscribe")
+		}
+	}
+	if current := states.Switch.Current; current != nil {
+		resolve(current, "current node")
+		if current.Via != nil {
+			resolve(current.Via, "relay node of current node")
+		}
+	}
+	for tag, node := range states.Switch.Tags {
+		resolve(&node, "current node of "+tag)
+		if node.Via != nil {
+			resolve(node.Via, "relay node of "+tag)
+		}
+		states.Switch.Tags[tag] = node
+	}
+	var group []int
+	groupCustom := false
+	for _, node := range states.Switch.Group {
+		if node.Custom {
+			groupCustom = true
+			group = append(group, node.Index)
+		} else if index, ok := indexes[node.Id]; ok {
+			group = append(group, index)
+		} else {
+			log.HandleError("update: group node " + strconv.Itoa(node.Index) + " is no longer in subscribe")
+		}
+	}
+	replace := make(map[string]string)
+	for tag, node := range states.Switch.Routes {
+		if node.Custom {
+			continue
+		}
+		if index, ok := indexes[node.Id]; ok {
+			if index != node.Index {
+				replace[tag] = "xrayhelper-" + strconv.Itoa(index)
+			}
+		} else {
+			// never regenerate the tag by index, it is another server now
+			log.HandleError("update: routed node " + tag + " is no longer in subscribe, route to " + builds.Config.XrayHelper.ProxyTag + " instead")
+			replace[tag] = builds.Config.XrayHelper.ProxyTag
+		}
+	}
+	if err := states.SaveSwitch(); err != nil {
+		return err
+	}
+	if len(replace) > 0 {
+		log.HandleInfo("update: re-resolve routed nodes")
+		if err := routes.ReplaceOutboundTag(replace); err != nil {
+			return err
+		}
+	}
+	// regenerate the group by the refreshed nodes, custom nodes are not changed by subscribe
+	if len(states.Switch.Group) > 0 && !groupCustom {
+		if len(group) == 0 {
+			return e.New("all nodes of group are no longer in subscribe").WithPrefix(tagUpdate)
+		}
+		log.HandleInfo("update: regenerate node group")
+		return s.Group(false, group)
+	}
+	return nil
+}
+
 // updateYacdMeta update yacd-meta
 func updateYacdMeta() error {
 	yacdMetaZipPath := path.Join(builds.Config.XrayHelper.DataDir, "yacd-meta.zip")
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestResolveRemovedNode(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.json": `{"outbounds":[{"protocol":"freedom","tag":"proxy"},{"protocol":"freedom","tag":"direct"}],"routing":{"rules":[{"domain":["a.com"],"outboundTag":"xrayhelper-1"},{"domain":["b.com"],"outboundTag":"xrayhelper-2"}]}}`,
+		"sub.txt":     "trojan://pass@1.1.1.1:443#A\ntrojan://pass@2.2.2.2:443#B\ntrojan://pass@3.3.3.3:443#C\n",
+	})
+	builds.Config.XrayHelper.CoreType = "xray"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	builds.Config.XrayHelper.ProxyTag = "proxy"
+	routes.ClearRule()
+	t.Cleanup(routes.ClearRule)
+	// a.com routes to B and b.com routes to C
+	routes.GetRule()
+	if err := routes.ApplyRule(); err != nil {
+		t.Fatal(err)
+	}
+	// B is removed from subscribe, C moves to its index
+	if err := os.WriteFile(path.Join(dir, "sub.txt"), []byte("trojan://pass@1.1.1.1:443#A\ntrojan://pass@3.3.3.3:443#C\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveNodes(); err != nil {
+		t.Fatal(err)
+	}
+	routes.ClearRule()
+	var outbounds []string
+	for _, r := range routes.GetRule() {
+		ruleMap := r.(serial.OrderedMap)
+		tag, _ := ruleMap.Get("outboundTag")
+		outbounds = append(outbounds, serial.ToString(tag.Value))
+	}
+	if strings.Join(outbounds, ",") != "proxy,xrayhelper-1" {
+		t.Errorf("expect rules route to proxy,xrayhelper-1, got %v", outbounds)
+	}
+	result, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	if strings.Contains(string(result), "2.2.2.2") || !strings.Contains(string(result), "3.3.3.3") || strings.Contains(string(result), "xrayhelper-2") {
+		t.Errorf("expect only C routed:\n%s", result)
+	}
+}
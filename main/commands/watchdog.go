@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	"XrayHelper/main/controller"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
+	"XrayHelper/main/shareurls"
+	"XrayHelper/main/shareurls/addon"
+	"XrayHelper/main/states"
+	"XrayHelper/main/switches"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const tagWatchdog = "watchdog"
+
+type WatchdogCommand struct{}
+
+func (this *WatchdogCommand) Execute(args []string) error {
+	if err := builds.LoadConfig(); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return e.New("too many arguments").WithPrefix(tagWatchdog).WithPathObj(*this)
+	}
+	switch builds.Config.XrayHelper.CoreType {
+	case "xray", "sing-box", "hysteria2":
+	default:
+		return e.New("watchdog not support core type " + builds.Config.XrayHelper.CoreType).WithPrefix(tagWatchdog).WithPathObj(*this)
+	}
+	if builds.Config.Watchdog.Interval <= 0 || builds.Config.Watchdog.Failures <= 0 || builds.Config.Watchdog.Timeout <= 0 {
+		return e.New("watchdog interval, failures and timeout should be positive").WithPrefix(tagWatchdog).WithPathObj(*this)
+	}
+	match, err := candidateMatcher(builds.Config.Watchdog.Candidates)
+	if err != nil {
+		return err
+	}
+	interval := time.Duration(builds.Config.Watchdog.Interval) * time.Second
+	log.HandleInfo("watchdog: started, probe active node every " + interval.String())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := make(map[string]int)
+	for {
+		select {
+		case <-signals:
+			log.HandleInfo("watchdog: stopped")
+			return nil
+		case <-ticker.C:
+		}
+		if len(getServicePid()) == 0 {
+			failures = make(map[string]int)
+			continue
+		}
+		ctl, err := controller.Load()
+		if err != nil {
+			log.HandleDebug(err)
+			ctl = nil
+		}
+		for _, tag := range probeTags(ctl != nil) {
+			if delay := probeActive(ctl, tag); delay >= 0 {
+				log.HandleDebug("watchdog: probe " + tag + ", realping " + strconv.Itoa(delay) + "ms")
+				failures[tag] = 0
+				continue
+			}
+			failures[tag]++
+			log.HandleInfo("watchdog: probe " + tag + " failed (" + strconv.Itoa(failures[tag]) + "/" + strconv.Itoa(builds.Config.Watchdog.Failures) + ")")
+			if failures[tag] >= builds.Config.Watchdog.Failures {
+				if err := failover(tag, match); err != nil {
+					log.HandleError(err)
+				}
+				failures[tag] = 0
+			}
+		}
+	}
+}
+
+// probeTags the outbound tags to probe, proxyTag and the switched proxyTags, only proxyTag can be probed without core controller
+func probeTags(controlled bool) []string {
+	tags := []string{builds.Config.XrayHelper.ProxyTag}
+	if !controlled {
+		return tags
+	}
+	if err := states.LoadSwitch(); err != nil {
+		log.HandleDebug(err)
+		return tags
+	}
+	for tag := range states.Switch.Tags {
+		if tag != builds.Config.XrayHelper.ProxyTag && common.IsProxyTag(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags[1:])
+	return tags
+}
+
+// probeActive test the outbound of tag through the running core, return -1 if failed
+func probeActive(ctl *controller.Controller, tag string) int {
+	timeout := time.Duration(builds.Config.Watchdog.Timeout) * time.Second
+	if ctl != nil {
+		return ctl.Delay(tag, builds.Config.Speedtest.Url, timeout)
+	}
+	return shareurls.PingSocks(builds.Config.Proxy.SocksPort, timeout)
+}
+
+// candidateMatcher every candidate is a node id or a regular expression of node remarks, empty means all nodes
+func candidateMatcher(candidates []string) (func(info *addon.NodeInfo) bool, error) {
+	var patterns []*regexp.Regexp
+	for _, candidate := range candidates {
+		re, err := regexp.Compile(candidate)
+		if err != nil {
+			return nil, e.New("invalid watchdog candidate "+candidate+", ", err).WithPrefix(tagWatchdog)
+		}
+		patterns = append(patterns, re)
+	}
+	return func(info *addon.NodeInfo) bool {
+		if len(candidates) == 0 {
+			return true
+		}
+		for i, re := range patterns {
+			if info.Id == candidates[i] || re.MatchString(info.Remarks) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// pingNodes test realping of nodes for failover
+var pingNodes = realPingNodes
+
+// failover switch the outbound of tag to the next healthy candidate node after the current one, the relay of chain is kept,
+// the node group is left alone, its balancer or urltest fails over by itself
+func failover(tag string, match func(info *addon.NodeInfo) bool) error {
+	custom := builds.Config.Watchdog.Custom
+	if err := states.LoadSwitch(); err != nil {
+		return err
+	}
+	active := states.Switch.Current
+	if tag != builds.Config.XrayHelper.ProxyTag {
+		active = nil
+		if node, ok := states.Switch.Tags[tag]; ok {
+			active = &node
+		}
+	} else if len(states.Switch.Group) > 0 {
+		log.HandleInfo("watchdog: node group is active on " + tag + ", skip failover")
+		return nil
+	}
+	switcher, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType)
+	if err != nil {
+		return err
+	}
+	if err := switcher.Target(tag); err != nil {
+		return err
+	}
+	current := -1
+	var via *states.Node
+	if active != nil {
+		if active.Custom == custom {
+			current = active.Index
+		}
+		via = active.Via
+	}
+	var before, after []int
+	for _, index := range switcher.Find(custom, func(string) bool { return true }) {
+		if index == current {
+			continue
+		}
+		if url, ok := switcher.Choose(custom, index).(shareurls.ShareUrl); ok && match(url.GetNodeInfo()) {
+			// keep the candidate order, start from the node next to current one
+			if index > current {
+				after = append(after, index)
+			} else {
+				before = append(before, index)
+			}
+		}
+	}
+	switcher.Clear()
+	candidates := append(after, before...)
+	if len(candidates) == 0 {
+		return e.New("failover " + tag + " failed, cannot find any candidate node").WithPrefix(tagWatchdog)
+	}
+	values := make(map[string]*shareurls.Result)
+	for _, result := range pingNodes(custom, candidates) {
+		values[result.Index] = result
+	}
+	for _, index := range candidates {
+		result, ok := values[strconv.Itoa(index)]
+		if !ok || result.Value < 0 {
+			continue
+		}
+		if via != nil {
+			err = switcher.Chain(custom, index, via.Custom, via.Index)
+		} else {
+			err = switcher.Set(custom, index)
+		}
+		if err != nil {
+			return err
+		}
+		log.HandleInfo("watchdog: failover " + tag + " from node [" + strconv.Itoa(current) + "] to [" + result.Index + "] " + result.Url.GetNodeInfo().Remarks + ", realping " + strconv.Itoa(result.Value) + "ms")
+		return restartAfterSwitch(switcher)
+	}
+	return e.New("failover " + tag + " failed, no healthy node in " + strconv.Itoa(len(candidates)) + " candidate nodes").WithPrefix(tagWatchdog)
+}
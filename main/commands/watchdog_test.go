@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/shareurls"
+	"XrayHelper/main/shareurls/addon"
+	"XrayHelper/main/states"
+	"XrayHelper/main/switches/ray"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestCandidateMatcher(t *testing.T) {
+	if _, err := candidateMatcher([]string{"("}); err == nil {
+		t.Error("expect invalid regular expression")
+	}
+	all, _ := candidateMatcher(nil)
+	match, _ := candidateMatcher([]string{"abcdef", "^HK"})
+	for _, c := range []struct {
+		info  addon.NodeInfo
+		all   bool
+		match bool
+	}{
+		{addon.NodeInfo{Id: "abcdef", Remarks: "US 01"}, true, true},
+		{addon.NodeInfo{Id: "123456", Remarks: "HK 01"}, true, true},
+		{addon.NodeInfo{Id: "123456", Remarks: "JP HK"}, true, false},
+	} {
+		if all(&c.info) != c.all || match(&c.info) != c.match {
+			t.Errorf("%+v: expect %v %v", c.info, c.all, c.match)
+		}
+	}
+}
+
+func TestFailover(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.json": `{"outbounds":[{"protocol":"freedom","tag":"proxy"},{"protocol":"freedom","tag":"proxy-us"}],"dns":{}}`,
+		"sub.txt":     "trojan://pass@1.1.1.1:443#A\ntrojan://pass@2.2.2.2:443#B\ntrojan://pass@3.3.3.3:443#C\n",
+	})
+	builds.Config.XrayHelper.CoreType = "xray"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	builds.Config.XrayHelper.ProxyTag = "proxy"
+	builds.Config.XrayHelper.ProxyTags = []string{"proxy-us"}
+	builds.Config.XrayHelper.RunDir = dir
+	// B is dead, C is healthy
+	pingNodes = func(custom bool, indexes []int) (results []*shareurls.Result) {
+		nodes, _ := shareurls.LoadNodes(custom)
+		for _, index := range indexes {
+			value := 100
+			if index == 1 {
+				value = -1
+			}
+			results = append(results, &shareurls.Result{Index: strconv.Itoa(index), Url: nodes[index], Value: value})
+		}
+		return
+	}
+	t.Cleanup(func() { pingNodes = realPingNodes })
+	match, _ := candidateMatcher(nil)
+	s := new(ray.RaySwitch)
+	if err := s.Set(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Target("proxy-us"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	s.Clear()
+	if err := failover("proxy-us", match); err != nil {
+		t.Fatal(err)
+	}
+	if err := states.LoadSwitch(); err != nil {
+		t.Fatal(err)
+	}
+	if states.Switch.Current.Index != 0 || states.Switch.Tags["proxy-us"].Index != 2 {
+		t.Errorf("expect only proxy-us failover to C, got %+v", states.Switch)
+	}
+	// the group fails over by itself
+	if err := new(ray.RaySwitch).Group(false, []int{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	if err := failover("proxy", match); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	if string(before) != string(after) {
+		t.Errorf("expect group kept, got:\n%s", after)
+	}
+	if err := new(ray.RaySwitch).Set(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := failover("proxy", match); err != nil {
+		t.Fatal(err)
+	}
+	if err := states.LoadSwitch(); err != nil {
+		t.Fatal(err)
+	}
+	if states.Switch.Current == nil || states.Switch.Current.Index != 2 {
+		t.Errorf("expect proxy failover to C, got %+v", states.Switch)
+	}
+}
@@ -0,0 +1,185 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// diffContext the unchanged lines around each change in unified diff
+const diffContext = 3
+
+// DryRun keep the changes of config files in memory instead of writing them, preview them by DryRunDiff
+var DryRun bool
+
+type pendingFile struct {
+	origin  []byte
+	current []byte
+}
+
+var (
+	pendingFiles = make(map[string]*pendingFile)
+	pendingOrder []string
+)
+
+// ReadConfFile read config file, return the pending change if exists in dry run
+func ReadConfFile(file string) ([]byte, error) {
+	if pending, ok := pendingFiles[file]; ok {
+		return pending.current, nil
+	}
+	return os.ReadFile(file)
+}
+
+// WriteConfFile write config file, or keep it as pending change in dry run
+func WriteConfFile(file string, data []byte) error {
+	if !DryRun {
+		return os.WriteFile(file, data, 0644)
+	}
+	pending, ok := pendingFiles[file]
+	if !ok {
+		// a nonexistent file is shown as new file
+		origin, _ := os.ReadFile(file)
+		pending = &pendingFile{origin: origin}
+		pendingFiles[file] = pending
+		pendingOrder = append(pendingOrder, file)
+	}
+	pending.current = data
+	return nil
+}
+
+// DryRunDiff the unified diff of all pending changes
+func DryRunDiff() string {
+	var builder strings.Builder
+	for _, file := range pendingOrder {
+		builder.WriteString(UnifiedDiff(file, pendingFiles[file].origin, pendingFiles[file].current))
+	}
+	return builder.String()
+}
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines the shortest edit script from a to b by myers algorithm
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] keeps v[-d..d] before round d
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	var reversed []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		if d == 0 {
+			for x > 0 && y > 0 {
+				reversed = append(reversed, diffLine{' ', a[x-1]})
+				x, y = x-1, y-1
+			}
+			break
+		}
+		get := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			reversed = append(reversed, diffLine{'+', b[y-1]})
+		} else {
+			reversed = append(reversed, diffLine{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	lines := make([]diffLine, len(reversed))
+	for i := range reversed {
+		lines[i] = reversed[len(reversed)-1-i]
+	}
+	return lines
+}
+
+// UnifiedDiff the unified diff of file from a to b, empty if no change
+func UnifiedDiff(name string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+	// line numbers before each diff line
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	var changes []int
+	for i, line := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if line.kind != '+' {
+			aLine[i+1]++
+		}
+		if line.kind != '-' {
+			bLine[i+1]++
+		}
+		if line.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	var builder strings.Builder
+	builder.WriteString("--- a/" + strings.TrimPrefix(name, "/") + "\n")
+	builder.WriteString("+++ b/" + strings.TrimPrefix(name, "/") + "\n")
+	for c := 0; c < len(changes); {
+		first, last := changes[c], changes[c]
+		for c++; c < len(changes) && changes[c]-last <= 2*diffContext; c++ {
+			last = changes[c]
+		}
+		start, end := max(0, first-diffContext), min(len(lines), last+diffContext+1)
+		builder.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aLine[start], aLine[end]-aLine[start]), hunkRange(bLine[start], bLine[end]-bLine[start])))
+		for _, line := range lines[start:end] {
+			builder.WriteByte(line.kind)
+			builder.WriteString(line.text)
+			builder.WriteByte('\n')
+		}
+	}
+	return builder.String()
+}
+
+// hunkRange format the range of hunk, the start line is the line before the hunk if it is empty
+func hunkRange(before int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
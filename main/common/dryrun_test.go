@@ -0,0 +1,45 @@
+package common_test
+
+import (
+	"XrayHelper/main/common"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\n", "--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n12\n",
+			"--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -8,5 +9,4 @@\n 8\n 9\n 10\n-11\n 12\n"},
+	}
+	for _, test := range tests {
+		if got := common.UnifiedDiff("f", []byte(test.a), []byte(test.b)); got != test.want {
+			t.Errorf("diff %q %q: expect\n%s\ngot\n%s", test.a, test.b, test.want, got)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	file := path.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	common.DryRun = true
+	defer func() { common.DryRun = false }()
+	_ = common.WriteConfFile(file, []byte("b\n"))
+	if data, _ := common.ReadConfFile(file); string(data) != "b\n" {
+		t.Errorf("expect pending change, got %q", data)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "a\n" {
+		t.Errorf("file should not be written in dry run, got %q", data)
+	}
+	if diff := common.DryRunDiff(); diff != "--- a/"+file[1:]+"\n+++ b/"+file[1:]+"\n@@ -1 +1 @@\n-a\n+b\n" {
+		t.Errorf("unexpected diff\n%s", diff)
+	}
+}
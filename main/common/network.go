@@ -4,6 +4,7 @@ import (
 	"XrayHelper/main/builds"
 	e "XrayHelper/main/errors"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -88,6 +90,41 @@ func CheckLocalPort(pid string, port string, timeout time.Duration) bool {
 	return false
 }
 
+// FreeLocalPorts find count loopback ports which are free for both tcp and udp downward from start, skip the ports in exclude
+func FreeLocalPorts(start int, count int, exclude map[int]bool) ([]int, error) {
+	var ports []int
+	for port := start; port > 1024 && len(ports) < count; port-- {
+		if !exclude[port] && isLoopbackPortFree(port) {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) < count {
+		return nil, e.New("cannot find " + strconv.Itoa(count) + " free ports below " + strconv.Itoa(start)).WithPrefix(tagNetwork)
+	}
+	return ports, nil
+}
+
+// isLoopbackPortFree check the port can be listened on both ipv4 and ipv6 loopback address, ipv6 is skipped if it is not available
+func isLoopbackPortFree(port int) bool {
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			if host == "::1" && errors.Is(err, syscall.EADDRNOTAVAIL) {
+				continue
+			}
+			return false
+		}
+		_ = listener.Close()
+		packetConn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		_ = packetConn.Close()
+	}
+	return true
+}
+
 func IsIPv6(cidr string) bool {
 	ip, _, _ := net.ParseCIDR(cidr)
 	if ip != nil && ip.To4() == nil {
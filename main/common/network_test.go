@@ -0,0 +1,47 @@
+package common_test
+
+import (
+	"XrayHelper/main/common"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestFreeLocalPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	used := listener.Addr().(*net.TCPAddr).Port
+	ports, err := common.FreeLocalPorts(used+1, 3, map[int]bool{used - 1: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 3 {
+		t.Fatalf("expect 3 ports, got %v", ports)
+	}
+	for _, port := range ports {
+		if port == used || port == used-1 || port > used+1 {
+			t.Errorf("port %d should not be allocated, used %d", port, used)
+		}
+		if l, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port)); err != nil {
+			t.Errorf("port %d is not free, %v", port, err)
+		} else {
+			_ = l.Close()
+		}
+	}
+	// a port bound on loopback only by another app
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packetConn.Close()
+	udpUsed := packetConn.LocalAddr().(*net.UDPAddr).Port
+	if ports, err := common.FreeLocalPorts(udpUsed, 1, nil); err != nil || ports[0] == udpUsed {
+		t.Errorf("expect udp port %d not allocated, got %v %v", udpUsed, ports, err)
+	}
+	if _, err := common.FreeLocalPorts(1030, 10, nil); err == nil {
+		t.Errorf("expect error when not enough ports")
+	}
+}
@@ -101,14 +101,14 @@ func HandleCoreConfDir(handler func(c []byte) (bool, []byte, error)) error {
 		if confDir, err := os.ReadDir(builds.Config.XrayHelper.CoreConfig); err == nil {
 			for _, conf := range confDir {
 				if !conf.IsDir() && strings.HasSuffix(conf.Name(), ".json") {
-					if confByte, err := os.ReadFile(path.Join(builds.Config.XrayHelper.CoreConfig, conf.Name())); err == nil {
+					if confByte, err := ReadConfFile(path.Join(builds.Config.XrayHelper.CoreConfig, conf.Name())); err == nil {
 						needSave, confByte, err := handler(confByte)
 						if err != nil {
 							log.HandleDebug(err)
 							continue
 						}
 						if needSave {
-							if err = os.WriteFile(path.Join(builds.Config.XrayHelper.CoreConfig, conf.Name()), confByte, 0644); err != nil {
+							if err = WriteConfFile(path.Join(builds.Config.XrayHelper.CoreConfig, conf.Name()), confByte); err != nil {
 								log.HandleDebug("write new config failed, " + err.Error())
 							}
 						}
@@ -118,13 +118,13 @@ func HandleCoreConfDir(handler func(c []byte) (bool, []byte, error)) error {
 			}
 		}
 	} else {
-		if confByte, err := os.ReadFile(builds.Config.XrayHelper.CoreConfig); err == nil {
+		if confByte, err := ReadConfFile(builds.Config.XrayHelper.CoreConfig); err == nil {
 			needSave, confByte, err := handler(confByte)
 			if err != nil {
 				return err
 			}
 			if needSave {
-				if err = os.WriteFile(path.Join(builds.Config.XrayHelper.CoreConfig), confByte, 0644); err != nil {
+				if err = WriteConfFile(builds.Config.XrayHelper.CoreConfig, confByte); err != nil {
 					return e.New("write new config failed, " + err.Error()).WithPrefix(tagUtil)
 				}
 			}
@@ -134,3 +134,47 @@ func HandleCoreConfDir(handler func(c []byte) (bool, []byte, error)) error {
 	}
 	return nil
 }
+
+// ReadCoreConfDir read every json file of conf dir type json core config, or the single config file
+func ReadCoreConfDir(handler func(c []byte) error) error {
+	confInfo, err := os.Stat(builds.Config.XrayHelper.CoreConfig)
+	if err != nil {
+		return e.New("open core config file failed, " + err.Error()).WithPrefix(tagUtil)
+	}
+	if !confInfo.IsDir() {
+		confByte, err := ReadConfFile(builds.Config.XrayHelper.CoreConfig)
+		if err != nil {
+			return e.New("read core config file failed").WithPrefix(tagUtil)
+		}
+		return handler(confByte)
+	}
+	confDir, err := os.ReadDir(builds.Config.XrayHelper.CoreConfig)
+	if err != nil {
+		return e.New("read core config dir failed, " + err.Error()).WithPrefix(tagUtil)
+	}
+	for _, conf := range confDir {
+		if !conf.IsDir() && strings.HasSuffix(conf.Name(), ".json") {
+			confByte, err := ReadConfFile(path.Join(builds.Config.XrayHelper.CoreConfig, conf.Name()))
+			if err != nil {
+				return e.New("read core config file "+conf.Name()+" failed, ", err).WithPrefix(tagUtil)
+			}
+			if err := handler(confByte); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsProxyTag whether the outbound (proxy group for mihomo) of tag can be switched, proxyTag or one of proxyTags
+func IsProxyTag(tag string) bool {
+	if tag == builds.Config.XrayHelper.ProxyTag {
+		return true
+	}
+	for _, proxyTag := range builds.Config.XrayHelper.ProxyTags {
+		if tag == proxyTag {
+			return true
+		}
+	}
+	return false
+}
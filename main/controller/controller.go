@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"bytes"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+const (
+	tagController = "controller"
+	timeout       = 3 * time.Second
+)
+
+// Controller the client of core RESTful controller, mihomo external-controller or sing-box clash_api
+type Controller struct {
+	address string
+	secret  string
+	client  *http.Client
+}
+
+// New returns a controller client with address and secret
+func New(address string, secret string) *Controller {
+	return &Controller{
+		address: normalizeAddress(address),
+		secret:  secret,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Load get the controller exposed by current core config
+func Load() (*Controller, error) {
+	var address, secret string
+	switch builds.Config.XrayHelper.CoreType {
+	case "sing-box":
+		read := func(c []byte) (bool, []byte, error) {
+			var jsonMap serial.OrderedMap
+			if err := json.Unmarshal(c, &jsonMap); err != nil {
+				return false, nil, e.New("unmarshal config json failed, ", err).WithPrefix(tagController)
+			}
+			if experimental, ok := jsonMap.Get("experimental"); ok {
+				experimentalMap := experimental.Value.(serial.OrderedMap)
+				if clashApi, ok := experimentalMap.Get("clash_api"); ok {
+					clashApiMap := clashApi.Value.(serial.OrderedMap)
+					if controller, ok := clashApiMap.Get("external_controller"); ok {
+						address, _ = controller.Value.(string)
+						if s, ok := clashApiMap.Get("secret"); ok {
+							secret, _ = s.Value.(string)
+						}
+						return false, nil, nil
+					}
+				}
+			}
+			return false, nil, e.New("cannot find clash_api from your config").WithPrefix(tagController)
+		}
+		if err := common.HandleCoreConfDir(read); err != nil {
+			return nil, err
+		}
+	case "mihomo":
+		configFile, err := os.ReadFile(path.Join(builds.Config.XrayHelper.CoreConfig, "config.yaml"))
+		if err != nil {
+			return nil, e.New("load clash config failed, ", err).WithPrefix(tagController)
+		}
+		var yamlMap serial.OrderedMap
+		if err := yaml.Unmarshal(configFile, &yamlMap); err != nil {
+			return nil, e.New("unmarshal clash config failed, ", err).WithPrefix(tagController)
+		}
+		if controller, ok := yamlMap.Get("external-controller"); ok {
+			address, _ = controller.Value.(string)
+		}
+		if s, ok := yamlMap.Get("secret"); ok {
+			secret, _ = s.Value.(string)
+		}
+	default:
+		return nil, e.New("core type " + builds.Config.XrayHelper.CoreType + " not expose any controller").WithPrefix(tagController)
+	}
+	if len(address) == 0 {
+		return nil, e.New("controller not enabled in your config").WithPrefix(tagController)
+	}
+	return New(address, secret), nil
+}
+
+// GetProxy get the proxy or proxy group object by name
+func (this *Controller) GetProxy(name string) (*serial.OrderedMap, error) {
+	response, err := this.request("GET", "/proxies/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return nil, e.New("get proxy " + name + " failed, bad http status " + response.Status).WithPrefix(tagController)
+	}
+	var proxy serial.OrderedMap
+	if err := json.NewDecoder(response.Body).Decode(&proxy); err != nil {
+		return nil, e.New("decode proxy "+name+" failed, ", err).WithPrefix(tagController)
+	}
+	return &proxy, nil
+}
+
+// SelectProxy change the selected proxy of a selector group
+func (this *Controller) SelectProxy(group string, name string) error {
+	var body serial.OrderedMap
+	body.Set("name", name)
+	marshal, err := json.Marshal(body)
+	if err != nil {
+		return e.New("marshal request body failed, ", err).WithPrefix(tagController)
+	}
+	response, err := this.request("PUT", "/proxies/"+url.PathEscape(group), marshal)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return e.New("select proxy " + name + " for " + group + " failed, bad http status " + response.Status).WithPrefix(tagController)
+	}
+	return nil
+}
+
+// Delay test the delay of proxy by core, return -1 if failed
+func (this *Controller) Delay(name string, testUrl string, timeout time.Duration) int {
+	query := url.Values{}
+	query.Set("url", testUrl)
+	query.Set("timeout", strconv.Itoa(int(timeout.Milliseconds())))
+	response, err := this.request("GET", "/proxies/"+url.PathEscape(name)+"/delay?"+query.Encode(), nil)
+	if err != nil {
+		return -1
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return -1
+	}
+	var delay serial.OrderedMap
+	if err := json.NewDecoder(response.Body).Decode(&delay); err != nil {
+		return -1
+	}
+	if d, ok := delay.Get("delay"); ok {
+		if value, err := strconv.Atoi(serial.ToString(d.Value)); err == nil {
+			return value
+		}
+	}
+	return -1
+}
+
+// request send a request to controller
+func (this *Controller) request(method string, api string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequest(method, "http://"+this.address+api, bytes.NewReader(body))
+	if err != nil {
+		return nil, e.New("create request failed, ", err).WithPrefix(tagController)
+	}
+	if len(this.secret) > 0 {
+		request.Header.Set("Authorization", "Bearer "+this.secret)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := this.client.Do(request)
+	if err != nil {
+		return nil, e.New("request controller failed, ", err).WithPrefix(tagController)
+	}
+	return response, nil
+}
+
+// normalizeAddress replace the unspecified listen address with loopback address
+func normalizeAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,69 @@
+package controller_test
+
+import (
+	"XrayHelper/main/controller"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestController(t *testing.T) {
+	now := "node-a"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			if r.URL.Path == "/proxies/proxy/delay" {
+				if r.URL.Query().Get("url") == "" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"delay": 120})
+				return
+			}
+			if r.URL.Path != "/proxies/proxy" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"type": "Selector", "now": now, "all": []string{"node-a", "node-b"}})
+		case "PUT":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			now = body["name"]
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	ctl := controller.New(strings.TrimPrefix(server.URL, "http://"), "secret")
+	if err := ctl.SelectProxy("proxy", "node-b"); err != nil {
+		t.Fatal(err)
+	}
+	group, err := ctl.GetProxy("proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := group.Get("now"); !ok || n.Value != "node-b" {
+		t.Errorf("expect node-b selected, got %v", n)
+	}
+	if delay := ctl.Delay("proxy", "https://example.com", time.Second); delay != 120 {
+		t.Errorf("expect delay 120, got %d", delay)
+	}
+	if delay := ctl.Delay("missing", "https://example.com", time.Second); delay != -1 {
+		t.Errorf("expect delay -1 for missing proxy, got %d", delay)
+	}
+	if _, err := ctl.GetProxy("missing"); err == nil {
+		t.Error("expect error for missing proxy")
+	}
+	if err := controller.New(strings.TrimPrefix(server.URL, "http://"), "wrong").SelectProxy("proxy", "node-a"); err == nil {
+		t.Error("expect error for wrong secret")
+	}
+}
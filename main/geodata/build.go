@@ -0,0 +1,160 @@
+package geodata
+
+import (
+	e "XrayHelper/main/errors"
+	"bufio"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseList parse a plain-text list into geosite and geoip category named code, nil if the list has no domain or cidr,
+// every line is a domain rule with prefix domain:, full:, regexp: or keyword: (domain: by default) and optional attributes like @cn,
+// or an ip or cidr, the text after # is comment
+func ParseList(code string, reader io.Reader) (*GeoSite, *GeoIP, error) {
+	code = strings.ToUpper(code)
+	geosite := &GeoSite{CountryCode: code}
+	geoip := &GeoIP{CountryCode: code}
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		where := code + " line " + strconv.Itoa(line)
+		if cidr, ok := parseCidr(fields[0]); ok {
+			if len(fields) > 1 {
+				return nil, nil, e.New(where + ", cidr cannot have attributes").WithPrefix(tagGeodata)
+			}
+			geoip.Cidr = append(geoip.Cidr, cidr)
+			continue
+		}
+		domain := Domain{Type: RootDomain, Value: fields[0]}
+		if prefix, value, found := strings.Cut(fields[0], ":"); found {
+			switch prefix {
+			case "domain":
+				domain.Type = RootDomain
+			case "full":
+				domain.Type = Full
+			case "keyword":
+				domain.Type = Plain
+			case "regexp":
+				domain.Type = Regex
+				if _, err := regexp.Compile(value); err != nil {
+					return nil, nil, e.New(where+", invalid regexp, ", err).WithPrefix(tagGeodata)
+				}
+			default:
+				return nil, nil, e.New(where + ", unknown prefix " + prefix).WithPrefix(tagGeodata)
+			}
+			domain.Value = value
+		}
+		if len(domain.Value) == 0 {
+			return nil, nil, e.New(where + ", empty domain").WithPrefix(tagGeodata)
+		}
+		if domain.Type != Regex {
+			domain.Value = strings.ToLower(domain.Value)
+		}
+		for _, attr := range fields[1:] {
+			if !strings.HasPrefix(attr, "@") || len(attr) == 1 {
+				return nil, nil, e.New(where + ", invalid attribute " + attr).WithPrefix(tagGeodata)
+			}
+			domain.Attribute = append(domain.Attribute, Attribute{Key: strings.ToLower(attr[1:]), BoolValue: true})
+		}
+		geosite.Domain = append(geosite.Domain, domain)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, e.New("read list "+code+" failed, ", err).WithPrefix(tagGeodata)
+	}
+	if len(geosite.Domain) == 0 {
+		geosite = nil
+	}
+	if len(geoip.Cidr) == 0 {
+		geoip = nil
+	}
+	return geosite, geoip, nil
+}
+
+// BuildDir parse all list files in dir, the file name without extension is the category code
+func BuildDir(dir string) ([]*GeoSite, []*GeoIP, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, e.New("read list dir failed, ", err).WithPrefix(tagGeodata)
+	}
+	var (
+		geositeList []*GeoSite
+		geoipList   []*GeoIP
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file, err := os.Open(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, e.New("open list failed, ", err).WithPrefix(tagGeodata)
+		}
+		geosite, geoip, err := ParseList(strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())), file)
+		_ = file.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if geosite != nil {
+			geositeList = append(geositeList, geosite)
+		}
+		if geoip != nil {
+			geoipList = append(geoipList, geoip)
+		}
+	}
+	return geositeList, geoipList, nil
+}
+
+// MergeGeoSite merge custom categories into the encoded base GeoSiteList, the base categories are kept byte by byte, the category with the same code is replaced
+func MergeGeoSite(base []byte, custom []*GeoSite) ([]byte, error) {
+	entries := make(map[string][]byte)
+	var order []string
+	for _, geosite := range custom {
+		code := strings.ToUpper(geosite.CountryCode)
+		if _, ok := entries[code]; !ok {
+			order = append(order, code)
+		}
+		entries[code] = marshalGeoSiteEntry(geosite)
+	}
+	merged, err := mergeList(base, entries, order)
+	if err != nil {
+		return nil, e.New("merge geosite file failed, ", err).WithPrefix(tagGeodata)
+	}
+	return merged, nil
+}
+
+// MergeGeoIP merge custom categories into the encoded base GeoIPList, the base categories are kept byte by byte, the category with the same code is replaced
+func MergeGeoIP(base []byte, custom []*GeoIP) ([]byte, error) {
+	entries := make(map[string][]byte)
+	var order []string
+	for _, geoip := range custom {
+		code := strings.ToUpper(geoip.CountryCode)
+		if _, ok := entries[code]; !ok {
+			order = append(order, code)
+		}
+		entries[code] = marshalGeoIPEntry(geoip)
+	}
+	merged, err := mergeList(base, entries, order)
+	if err != nil {
+		return nil, e.New("merge geoip file failed, ", err).WithPrefix(tagGeodata)
+	}
+	return merged, nil
+}
+
+// parseCidr parse an ip or cidr
+func parseCidr(text string) (netip.Prefix, bool) {
+	if cidr, err := netip.ParsePrefix(text); err == nil {
+		return cidr.Masked(), true
+	}
+	if ip, err := netip.ParseAddr(text); err == nil {
+		return netip.PrefixFrom(ip, ip.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
@@ -0,0 +1,62 @@
+package geodata_test
+
+import (
+	"XrayHelper/main/geodata"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	list := `# corporate domains
+corp.example
+full:VPN.corp.example @internal @cn
+regexp:^git[0-9]+\.corp$
+keyword:corpcdn # comment
+10.8.0.0/16
+192.168.7.1
+`
+	geosite, geoip, err := geodata.ParseList("ourcorp", strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSite := &geodata.GeoSite{CountryCode: "OURCORP", Domain: []geodata.Domain{
+		{Type: geodata.RootDomain, Value: "corp.example"},
+		{Type: geodata.Full, Value: "vpn.corp.example", Attribute: []geodata.Attribute{{Key: "internal", BoolValue: true}, {Key: "cn", BoolValue: true}}},
+		{Type: geodata.Regex, Value: `^git[0-9]+\.corp$`},
+		{Type: geodata.Plain, Value: "corpcdn"},
+	}}
+	if !reflect.DeepEqual(geosite, expectSite) {
+		t.Errorf("unexpected geosite %+v", geosite)
+	}
+	expectIP := &geodata.GeoIP{CountryCode: "OURCORP", Cidr: []netip.Prefix{netip.MustParsePrefix("10.8.0.0/16"), netip.MustParsePrefix("192.168.7.1/32")}}
+	if !reflect.DeepEqual(geoip, expectIP) {
+		t.Errorf("unexpected geoip %+v", geoip)
+	}
+	for _, bad := range []string{"include:other", "regexp:(", "10.0.0.0/8 @cn", "example.com cn"} {
+		if _, _, err := geodata.ParseList("bad", strings.NewReader(bad)); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+
+	// upstream entries may have fields not modeled here, such as resource_hash, they should be kept
+	cn := append(geodata.MarshalGeoSite([]*geodata.GeoSite{{CountryCode: "CN"}})[2:], 0x1a, 0x02, 0xab, 0xcd)
+	base := append([]byte{0x0a, byte(len(cn))}, cn...)
+	base = append(base, geodata.MarshalGeoSite([]*geodata.GeoSite{{CountryCode: "ourcorp"}})...)
+	base = append(base, 0x10, 0x07)
+	merged, err := geodata.MergeGeoSite(base, []*geodata.GeoSite{geosite, {CountryCode: "STREAMING"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := append([]byte{0x0a, byte(len(cn))}, cn...)
+	expect = append(expect, geodata.MarshalGeoSite([]*geodata.GeoSite{geosite})...)
+	expect = append(expect, 0x10, 0x07)
+	expect = append(expect, geodata.MarshalGeoSite([]*geodata.GeoSite{{CountryCode: "STREAMING"}})...)
+	if !reflect.DeepEqual(merged, expect) {
+		t.Errorf("unexpected merged geosite %x", merged)
+	}
+	if _, err := geodata.MergeGeoIP([]byte{0x0a, 0x05}, []*geodata.GeoIP{geoip}); err == nil {
+		t.Errorf("expect error for broken geoip")
+	}
+}
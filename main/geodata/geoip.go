@@ -0,0 +1,155 @@
+package geodata
+
+import (
+	e "XrayHelper/main/errors"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+const tagGeodata = "geodata"
+
+// GeoIP a category of geoip.dat, CountryCode is the category name like CN or PRIVATE
+type GeoIP struct {
+	CountryCode  string
+	Cidr         []netip.Prefix
+	ReverseMatch bool
+}
+
+// LoadGeoIP read the geoip list from v2ray geoip.dat file
+func LoadGeoIP(file string) ([]*GeoIP, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, e.New("read geoip file failed, ", err).WithPrefix(tagGeodata)
+	}
+	return UnmarshalGeoIP(data)
+}
+
+// UnmarshalGeoIP decode the protobuf message GeoIPList
+func UnmarshalGeoIP(data []byte) ([]*GeoIP, error) {
+	var list []*GeoIP
+	err := readFields(data, func(f *field) error {
+		if f.Num != 1 || f.Type != wireBytes {
+			return nil
+		}
+		geoip := new(GeoIP)
+		if err := readFields(f.Bytes, func(f *field) error {
+			switch f.Num {
+			case 1:
+				geoip.CountryCode = string(f.Bytes)
+			case 2:
+				cidr, err := unmarshalCidr(f.Bytes)
+				if err != nil {
+					return err
+				}
+				geoip.Cidr = append(geoip.Cidr, cidr)
+			case 3:
+				geoip.ReverseMatch = f.Varint != 0
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		list = append(list, geoip)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// MarshalGeoIP encode the geoip list to protobuf message GeoIPList
+func MarshalGeoIP(list []*GeoIP) []byte {
+	var data []byte
+	for _, geoip := range list {
+		data = appendBytesField(data, 1, marshalGeoIPEntry(geoip))
+	}
+	return data
+}
+
+// marshalGeoIPEntry encode the protobuf message GeoIP
+func marshalGeoIPEntry(geoip *GeoIP) []byte {
+	var entry []byte
+	entry = appendBytesField(entry, 1, []byte(geoip.CountryCode))
+	for _, cidr := range geoip.Cidr {
+		var c []byte
+		c = appendBytesField(c, 1, cidr.Addr().AsSlice())
+		c = appendVarintField(c, 2, uint64(cidr.Bits()))
+		entry = appendBytesField(entry, 2, c)
+	}
+	if geoip.ReverseMatch {
+		entry = appendVarintField(entry, 3, 1)
+	}
+	return entry
+}
+
+// unmarshalCidr decode the protobuf message CIDR
+func unmarshalCidr(data []byte) (netip.Prefix, error) {
+	var (
+		ip     []byte
+		prefix uint64
+	)
+	if err := readFields(data, func(f *field) error {
+		switch f.Num {
+		case 1:
+			ip = f.Bytes
+		case 2:
+			prefix = f.Varint
+		}
+		return nil
+	}); err != nil {
+		return netip.Prefix{}, err
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, e.New("bad geoip cidr address").WithPrefix(tagGeodata)
+	}
+	cidr, err := addr.Prefix(int(prefix))
+	if err != nil {
+		return netip.Prefix{}, e.New("bad geoip cidr prefix, ", err).WithPrefix(tagGeodata)
+	}
+	return cidr, nil
+}
+
+// Contains check whether the geoip category contains ip
+func (this *GeoIP) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, cidr := range this.Cidr {
+		if cidr.Contains(ip) {
+			return !this.ReverseMatch
+		}
+	}
+	return this.ReverseMatch
+}
+
+// MatchIP get the codes of all geoip categories which contain ip
+func MatchIP(list []*GeoIP, ip netip.Addr) []string {
+	var codes []string
+	for _, geoip := range list {
+		if geoip.Contains(ip) {
+			codes = append(codes, geoip.CountryCode)
+		}
+	}
+	return codes
+}
+
+// Country get the two-letter country code of ip, categories like PRIVATE or TELEGRAM are ignored, empty if not found
+func Country(list []*GeoIP, ip netip.Addr) string {
+	for _, code := range MatchIP(list, ip) {
+		if len(code) == 2 {
+			return strings.ToUpper(code)
+		}
+	}
+	return ""
+}
+
+// FindGeoIP get the geoip category by code, case-insensitive
+func FindGeoIP(list []*GeoIP, code string) *GeoIP {
+	for _, geoip := range list {
+		if strings.EqualFold(geoip.CountryCode, code) {
+			return geoip
+		}
+	}
+	return nil
+}
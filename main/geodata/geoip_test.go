@@ -0,0 +1,40 @@
+package geodata_test
+
+import (
+	"XrayHelper/main/geodata"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestGeoIP(t *testing.T) {
+	list := []*geodata.GeoIP{
+		{CountryCode: "PRIVATE", Cidr: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		{CountryCode: "CN", Cidr: []netip.Prefix{netip.MustParsePrefix("1.0.1.0/24"), netip.MustParsePrefix("240e::/18")}},
+		{CountryCode: "JP", Cidr: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}},
+		{CountryCode: "NOT-CN", Cidr: []netip.Prefix{netip.MustParsePrefix("1.0.1.0/24")}, ReverseMatch: true},
+	}
+	decoded, err := geodata.UnmarshalGeoIP(geodata.MarshalGeoIP(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, list) {
+		t.Fatalf("decoded geoip list not equal")
+	}
+	if country := geodata.Country(decoded, netip.MustParseAddr("1.0.1.1")); country != "CN" {
+		t.Errorf("expect CN, got %s", country)
+	}
+	if country := geodata.Country(decoded, netip.MustParseAddr("240e::1")); country != "CN" {
+		t.Errorf("expect CN, got %s", country)
+	}
+	// PRIVATE is not a country
+	if country := geodata.Country(decoded, netip.MustParseAddr("10.1.2.3")); country != "JP" {
+		t.Errorf("expect JP, got %s", country)
+	}
+	if codes := geodata.MatchIP(decoded, netip.MustParseAddr("8.8.8.8")); !reflect.DeepEqual(codes, []string{"NOT-CN"}) {
+		t.Errorf("expect [NOT-CN], got %v", codes)
+	}
+	if _, err := geodata.UnmarshalGeoIP([]byte{0x0a, 0x05, 0x0a}); err == nil {
+		t.Errorf("expect error for truncated data")
+	}
+}
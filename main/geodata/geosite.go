@@ -0,0 +1,234 @@
+package geodata
+
+import (
+	e "XrayHelper/main/errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DomainType the match type of geosite domain
+type DomainType int
+
+const (
+	Plain DomainType = iota
+	Regex
+	RootDomain
+	Full
+)
+
+// typePrefix the prefix of domain rule in v2ray config
+var typePrefix = map[DomainType]string{Plain: "keyword", Regex: "regexp", RootDomain: "domain", Full: "full"}
+
+// Attribute the attribute of geosite domain, like @cn or @ads
+type Attribute struct {
+	Key       string
+	BoolValue bool
+	IntValue  int64
+}
+
+// Domain a domain rule of geosite category
+type Domain struct {
+	Type      DomainType
+	Value     string
+	Attribute []Attribute
+}
+
+// GeoSite a category of geosite.dat, CountryCode is the category name like CN or GOOGLE
+type GeoSite struct {
+	CountryCode string
+	Domain      []Domain
+}
+
+// LoadGeoSite read the geosite list from v2ray geosite.dat file
+func LoadGeoSite(file string) ([]*GeoSite, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, e.New("read geosite file failed, ", err).WithPrefix(tagGeodata)
+	}
+	return UnmarshalGeoSite(data)
+}
+
+// UnmarshalGeoSite decode the protobuf message GeoSiteList
+func UnmarshalGeoSite(data []byte) ([]*GeoSite, error) {
+	var list []*GeoSite
+	err := readFields(data, func(f *field) error {
+		if f.Num != 1 || f.Type != wireBytes {
+			return nil
+		}
+		geosite := new(GeoSite)
+		if err := readFields(f.Bytes, func(f *field) error {
+			switch f.Num {
+			case 1:
+				geosite.CountryCode = string(f.Bytes)
+			case 2:
+				domain, err := unmarshalDomain(f.Bytes)
+				if err != nil {
+					return err
+				}
+				geosite.Domain = append(geosite.Domain, domain)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		list = append(list, geosite)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// MarshalGeoSite encode the geosite list to protobuf message GeoSiteList
+func MarshalGeoSite(list []*GeoSite) []byte {
+	var data []byte
+	for _, geosite := range list {
+		data = appendBytesField(data, 1, marshalGeoSiteEntry(geosite))
+	}
+	return data
+}
+
+// marshalGeoSiteEntry encode the protobuf message GeoSite
+func marshalGeoSiteEntry(geosite *GeoSite) []byte {
+	var entry []byte
+	entry = appendBytesField(entry, 1, []byte(geosite.CountryCode))
+	for _, domain := range geosite.Domain {
+		var d []byte
+		d = appendVarintField(d, 1, uint64(domain.Type))
+		d = appendBytesField(d, 2, []byte(domain.Value))
+		for _, attr := range domain.Attribute {
+			var a []byte
+			a = appendBytesField(a, 1, []byte(attr.Key))
+			if attr.BoolValue {
+				a = appendVarintField(a, 2, 1)
+			}
+			a = appendVarintField(a, 3, uint64(attr.IntValue))
+			d = appendBytesField(d, 3, a)
+		}
+		entry = appendBytesField(entry, 2, d)
+	}
+	return entry
+}
+
+// unmarshalDomain decode the protobuf message Domain
+func unmarshalDomain(data []byte) (Domain, error) {
+	var domain Domain
+	err := readFields(data, func(f *field) error {
+		switch f.Num {
+		case 1:
+			domain.Type = DomainType(f.Varint)
+		case 2:
+			domain.Value = string(f.Bytes)
+		case 3:
+			var attr Attribute
+			if err := readFields(f.Bytes, func(f *field) error {
+				switch f.Num {
+				case 1:
+					attr.Key = string(f.Bytes)
+				case 2:
+					attr.BoolValue = f.Varint != 0
+				case 3:
+					attr.IntValue = int64(f.Varint)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			domain.Attribute = append(domain.Attribute, attr)
+		}
+		return nil
+	})
+	return domain, err
+}
+
+// String the domain rule in v2ray config format, attributes are appended like domain:example.com:@cn
+func (this Domain) String() string {
+	prefix, ok := typePrefix[this.Type]
+	if !ok {
+		prefix = "type" + strconv.Itoa(int(this.Type))
+	}
+	rule := prefix + ":" + this.Value
+	for _, attr := range this.Attribute {
+		rule += ":@" + attr.Key
+	}
+	return rule
+}
+
+// HasAttribute check whether the domain has attribute key
+func (this Domain) HasAttribute(key string) bool {
+	for _, attr := range this.Attribute {
+		if strings.EqualFold(attr.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match check whether the domain rule matches domain
+func (this Domain) Match(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	value := strings.ToLower(this.Value)
+	switch this.Type {
+	case Plain:
+		return strings.Contains(domain, value)
+	case Regex:
+		re := compileRegexp(this.Value)
+		return re != nil && re.MatchString(domain)
+	case RootDomain:
+		return domain == value || strings.HasSuffix(domain, "."+value)
+	case Full:
+		return domain == value
+	}
+	return false
+}
+
+// regexps the compiled regexp of domain rules by pattern, nil if the pattern is invalid
+var regexps sync.Map
+
+// compileRegexp compile the pattern of domain rule once, return nil if it is invalid
+func compileRegexp(pattern string) *regexp.Regexp {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = nil
+	}
+	regexps.Store(pattern, re)
+	return re
+}
+
+// Contains check whether the geosite category contains domain
+func (this *GeoSite) Contains(domain string) bool {
+	for _, d := range this.Domain {
+		if d.Match(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchDomain get the codes of all geosite categories which contain domain
+func MatchDomain(list []*GeoSite, domain string) []string {
+	var codes []string
+	for _, geosite := range list {
+		if geosite.Contains(domain) {
+			codes = append(codes, geosite.CountryCode)
+		}
+	}
+	return codes
+}
+
+// FindGeoSite get the geosite category by code, case-insensitive
+func FindGeoSite(list []*GeoSite, code string) *GeoSite {
+	for _, geosite := range list {
+		if strings.EqualFold(geosite.CountryCode, code) {
+			return geosite
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package geodata_test
+
+import (
+	"XrayHelper/main/geodata"
+	"reflect"
+	"testing"
+)
+
+func TestGeoSite(t *testing.T) {
+	list := []*geodata.GeoSite{
+		{CountryCode: "GOOGLE", Domain: []geodata.Domain{
+			{Type: geodata.RootDomain, Value: "google.com"},
+			{Type: geodata.Full, Value: "www.gstatic.com", Attribute: []geodata.Attribute{{Key: "cn", BoolValue: true}}},
+		}},
+		{CountryCode: "CATEGORY-ADS", Domain: []geodata.Domain{
+			{Type: geodata.Plain, Value: "adservice"},
+			{Type: geodata.Regex, Value: `^ad\d+\.example\.com$`, Attribute: []geodata.Attribute{{Key: "rank", IntValue: -3}}},
+		}},
+	}
+	decoded, err := geodata.UnmarshalGeoSite(geodata.MarshalGeoSite(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, list) {
+		t.Fatalf("decoded geosite list not equal")
+	}
+	for domain, expect := range map[string][]string{
+		"google.com":           {"GOOGLE"},
+		"mail.Google.com.":     {"GOOGLE"},
+		"notgoogle.com":        nil,
+		"www.gstatic.com":      {"GOOGLE"},
+		"cdn.www.gstatic.com":  nil,
+		"adservice.google.com": {"GOOGLE", "CATEGORY-ADS"},
+		"ad12.example.com":     {"CATEGORY-ADS"},
+		"ad12.example.com.cn":  nil,
+	} {
+		if codes := geodata.MatchDomain(decoded, domain); !reflect.DeepEqual(codes, expect) {
+			t.Errorf("%s: expect %v, got %v", domain, expect, codes)
+		}
+	}
+	// the invalid regexp is cached as well
+	invalid := geodata.Domain{Type: geodata.Regex, Value: "("}
+	if invalid.Match("(") || invalid.Match("(") {
+		t.Errorf("invalid regexp should not match")
+	}
+	if geosite := geodata.FindGeoSite(decoded, "google"); geosite == nil || geosite.Domain[1].String() != "full:www.gstatic.com:@cn" {
+		t.Errorf("find geosite google failed")
+	}
+}
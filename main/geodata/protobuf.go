@@ -0,0 +1,125 @@
+package geodata
+
+import (
+	e "XrayHelper/main/errors"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// protobuf wire types used by geodata
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// field a decoded protobuf field, Varint is set for varint type and Bytes for length-delimited type, Raw is the encoded field
+type field struct {
+	Num    int
+	Type   int
+	Varint uint64
+	Bytes  []byte
+	Raw    []byte
+}
+
+// readFields decode all fields of a protobuf message
+func readFields(data []byte, handle func(f *field) error) error {
+	for len(data) > 0 {
+		start := data
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return e.New("bad protobuf tag").WithPrefix(tagGeodata)
+		}
+		data = data[n:]
+		f := &field{Num: int(tag >> 3), Type: int(tag & 7)}
+		switch f.Type {
+		case wireVarint:
+			f.Varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return e.New("bad protobuf varint of field " + strconv.Itoa(f.Num)).WithPrefix(tagGeodata)
+			}
+			data = data[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return e.New("bad protobuf length of field " + strconv.Itoa(f.Num)).WithPrefix(tagGeodata)
+			}
+			f.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case wireFixed64:
+			if len(data) < 8 {
+				return e.New("bad protobuf fixed64 of field " + strconv.Itoa(f.Num)).WithPrefix(tagGeodata)
+			}
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return e.New("bad protobuf fixed32 of field " + strconv.Itoa(f.Num)).WithPrefix(tagGeodata)
+			}
+			data = data[4:]
+		default:
+			return e.New("unsupported protobuf wire type " + strconv.Itoa(f.Type)).WithPrefix(tagGeodata)
+		}
+		f.Raw = start[:len(start)-len(data)]
+		if err := handle(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendVarintField encode a varint field, zero value is omitted
+func appendVarintField(buf []byte, num int, value uint64) []byte {
+	if value == 0 {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(buf, value)
+}
+
+// appendBytesField encode a length-delimited field
+func appendBytesField(buf []byte, num int, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(num)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// mergeList merge the encoded entries into the encoded list message (GeoSiteList or GeoIPList), the base entries are kept as they are,
+// so are the fields not modeled here, the base entry with the same code is replaced in place, the others are appended by order
+func mergeList(base []byte, entries map[string][]byte, order []string) ([]byte, error) {
+	var data []byte
+	merged := make(map[string]bool)
+	err := readFields(base, func(f *field) error {
+		if f.Num == 1 && f.Type == wireBytes {
+			var code string
+			if err := readFields(f.Bytes, func(f *field) error {
+				if f.Num == 1 && f.Type == wireBytes {
+					code = strings.ToUpper(string(f.Bytes))
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if entry, ok := entries[code]; ok {
+				if !merged[code] {
+					data = appendBytesField(data, 1, entry)
+					merged[code] = true
+				}
+				return nil
+			}
+		}
+		data = append(data, f.Raw...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range order {
+		if !merged[code] {
+			data = appendBytesField(data, 1, entries[code])
+			merged[code] = true
+		}
+	}
+	return data, nil
+}
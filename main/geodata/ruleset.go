@@ -0,0 +1,68 @@
+package geodata
+
+import (
+	"XrayHelper/main/serial"
+)
+
+// rulesetVersion the version of sing-box rule-set source format
+const rulesetVersion = 2
+
+// GeoSiteRuleset convert the geosite category to sing-box rule-set source, only keep the domains with attribute attr if not empty
+func GeoSiteRuleset(geosite *GeoSite, attr string) serial.OrderedMap {
+	var domain, suffix, keyword, regex serial.OrderedArray
+	for _, d := range geosite.Domain {
+		if len(attr) > 0 && !d.HasAttribute(attr) {
+			continue
+		}
+		switch d.Type {
+		case Full:
+			domain = append(domain, d.Value)
+		case RootDomain:
+			suffix = append(suffix, d.Value)
+		case Plain:
+			keyword = append(keyword, d.Value)
+		case Regex:
+			regex = append(regex, d.Value)
+		}
+	}
+	var rule serial.OrderedMap
+	if len(domain) > 0 {
+		rule.Set("domain", domain)
+	}
+	if len(suffix) > 0 {
+		rule.Set("domain_suffix", suffix)
+	}
+	if len(keyword) > 0 {
+		rule.Set("domain_keyword", keyword)
+	}
+	if len(regex) > 0 {
+		rule.Set("domain_regex", regex)
+	}
+	return ruleset(rule)
+}
+
+// GeoIPRuleset convert the geoip category to sing-box rule-set source
+func GeoIPRuleset(geoip *GeoIP) serial.OrderedMap {
+	var cidr serial.OrderedArray
+	for _, c := range geoip.Cidr {
+		cidr = append(cidr, c.String())
+	}
+	var rule serial.OrderedMap
+	rule.Set("ip_cidr", cidr)
+	if geoip.ReverseMatch {
+		rule.Set("invert", true)
+	}
+	return ruleset(rule)
+}
+
+// ruleset wrap the headless rule as rule-set source
+func ruleset(rule serial.OrderedMap) serial.OrderedMap {
+	var source serial.OrderedMap
+	source.Set("version", rulesetVersion)
+	var rules serial.OrderedArray
+	if len(rule.Values) > 0 {
+		rules = append(rules, rule)
+	}
+	source.Set("rules", rules)
+	return source
+}
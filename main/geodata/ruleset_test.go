@@ -0,0 +1,32 @@
+package geodata_test
+
+import (
+	"XrayHelper/main/geodata"
+	"encoding/json"
+	"net/netip"
+	"testing"
+)
+
+func TestRuleset(t *testing.T) {
+	geosite := &geodata.GeoSite{CountryCode: "GOOGLE", Domain: []geodata.Domain{
+		{Type: geodata.RootDomain, Value: "google.com"},
+		{Type: geodata.Full, Value: "g.cn", Attribute: []geodata.Attribute{{Key: "cn", BoolValue: true}}},
+		{Type: geodata.Plain, Value: "googleapis"},
+		{Type: geodata.Regex, Value: `^gg\d+\.com$`},
+	}}
+	for attr, expect := range map[string]string{
+		"":   `{"version":2,"rules":[{"domain":["g.cn"],"domain_suffix":["google.com"],"domain_keyword":["googleapis"],"domain_regex":["^gg\\d+\\.com$"]}]}`,
+		"cn": `{"version":2,"rules":[{"domain":["g.cn"]}]}`,
+		"ad": `{"version":2,"rules":[]}`,
+	} {
+		marshal, _ := json.Marshal(geodata.GeoSiteRuleset(geosite, attr))
+		if string(marshal) != expect {
+			t.Errorf("geosite@%s: expect %s, got %s", attr, expect, marshal)
+		}
+	}
+	geoip := &geodata.GeoIP{CountryCode: "CN", Cidr: []netip.Prefix{netip.MustParsePrefix("1.0.1.0/24"), netip.MustParsePrefix("240e::/18")}, ReverseMatch: true}
+	marshal, _ := json.Marshal(geodata.GeoIPRuleset(geoip))
+	if expect := `{"version":2,"rules":[{"ip_cidr":["1.0.1.0/24","240e::/18"],"invert":true}]}`; string(marshal) != expect {
+		t.Errorf("geoip: expect %s, got %s", expect, marshal)
+	}
+}
@@ -17,11 +17,15 @@ var Option struct {
 	VerboseFlag      bool   `short:"v" long:"verbose" description:"show verbose debug information"`
 	VersionFlag      bool   `short:"V" long:"version" description:"show current version"`
 
-	Service commands.ServiceCommand `command:"service" description:"control core service"`
-	Proxy   commands.ProxyCommand   `command:"proxy" description:"control system proxy"`
-	Update  commands.UpdateCommand  `command:"update" description:"update core, adghome, tun2socks, geodata, yacd-meta, metacubexd or subscribe"`
-	Switch  commands.SwitchCommand  `command:"switch" description:"switch proxy node or clash config"`
-	Api     commands.ApiCommand     `command:"api" description:"xrayhelper api for webui"`
+	Service  commands.ServiceCommand  `command:"service" description:"control core service"`
+	Proxy    commands.ProxyCommand    `command:"proxy" description:"control system proxy"`
+	Update   commands.UpdateCommand   `command:"update" description:"update core, adghome, tun2socks, geodata, yacd-meta, metacubexd or subscribe"`
+	Switch   commands.SwitchCommand   `command:"switch" description:"switch proxy node or clash config"`
+	Api      commands.ApiCommand      `command:"api" description:"xrayhelper api for webui"`
+	Watchdog commands.WatchdogCommand `command:"watchdog" description:"probe active proxy node and failover automatically"`
+	Route    commands.RouteCommand    `command:"route" description:"simulate the routing of core rules"`
+	Geo      commands.GeoCommand      `command:"geo" description:"list, show or match the categories of geoip.dat and geosite.dat"`
+	Custom   commands.CustomCommand   `command:"custom" description:"list, add, rename, exchange or delete custom nodes"`
 }
 
 // LoadOption load Option, the program entry
@@ -81,6 +81,9 @@ func GetDnsrule() serial.OrderedArray {
 
 // ApplyDnsrule sync dns rules to core config
 func ApplyDnsrule() error {
+	if err := validateDnsrule(); err != nil {
+		return err
+	}
 	replace := func(c []byte) (bool, []byte, error) {
 		var jsonMap serial.OrderedMap
 		err := json.Unmarshal(c, &jsonMap)
@@ -0,0 +1,470 @@
+package routes
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"XrayHelper/main/states"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"net/netip"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const tagPreset = "preset"
+
+// Preset a named and versioned bundle of routing rules
+type Preset struct {
+	Name        string       `yaml:"name"`
+	Version     int          `yaml:"version"`
+	Description string       `yaml:"description"`
+	Rules       []PresetRule `yaml:"rules"`
+}
+
+// PresetRule match if any domain or ip matches, and port and network match if set,
+// domain is in xray syntax (geosite:, domain:, full:, keyword:, regexp:), ip is geoip: or ip/cidr,
+// outbound is proxy, direct or block
+type PresetRule struct {
+	Domain   []string `yaml:"domain"`
+	IP       []string `yaml:"ip"`
+	Port     string   `yaml:"port"`
+	Network  string   `yaml:"network"`
+	Outbound string   `yaml:"outbound"`
+}
+
+// builtinPresets the presets shipped with xrayhelper, can be overridden by user preset with the same name
+var builtinPresets = []Preset{
+	{
+		Name: "private-direct", Version: 1, Description: "direct connect to private domains and ips",
+		Rules: []PresetRule{{Domain: []string{"geosite:private"}, IP: []string{"geoip:private"}, Outbound: "direct"}},
+	},
+	{
+		Name: "cn-direct", Version: 1, Description: "direct connect to mainland china domains and ips",
+		Rules: []PresetRule{{Domain: []string{"geosite:cn"}, IP: []string{"geoip:cn"}, Outbound: "direct"}},
+	},
+	{
+		Name: "ads-block", Version: 1, Description: "block advertisement domains",
+		Rules: []PresetRule{{Domain: []string{"geosite:category-ads-all"}, Outbound: "block"}},
+	},
+	{
+		Name: "telegram-proxy", Version: 1, Description: "proxy telegram domains and ip ranges",
+		Rules: []PresetRule{{Domain: []string{"geosite:telegram"}, IP: []string{"geoip:telegram"}, Outbound: "proxy"}},
+	},
+}
+
+// PresetDir the dir of user presets
+func PresetDir() string {
+	return path.Join(builds.Config.XrayHelper.DataDir, "preset")
+}
+
+// LoadPresets load builtin presets and user presets (*.yaml, *.yml) in PresetDir, sorted by name
+func LoadPresets() ([]Preset, error) {
+	presets := make(map[string]Preset)
+	for _, preset := range builtinPresets {
+		presets[preset.Name] = preset
+	}
+	if entries, err := os.ReadDir(PresetDir()); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() || (path.Ext(entry.Name()) != ".yaml" && path.Ext(entry.Name()) != ".yml") {
+				continue
+			}
+			presetByte, err := os.ReadFile(path.Join(PresetDir(), entry.Name()))
+			if err != nil {
+				return nil, e.New("read preset "+entry.Name()+" failed, ", err).WithPrefix(tagPreset)
+			}
+			var preset Preset
+			if err := yaml.Unmarshal(presetByte, &preset); err != nil {
+				return nil, e.New("unmarshal preset "+entry.Name()+" failed, ", err).WithPrefix(tagPreset)
+			}
+			if len(preset.Name) == 0 {
+				preset.Name = strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+			}
+			presets[preset.Name] = preset
+		}
+	}
+	var list []Preset
+	for _, preset := range presets {
+		list = append(list, preset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// FindPreset find preset by name
+func FindPreset(presets []Preset, name string) *Preset {
+	for i := range presets {
+		if presets[i].Name == name {
+			return &presets[i]
+		}
+	}
+	return nil
+}
+
+// PresetOutbounds resolve proxy, direct and block to the outbound tags of current core,
+// an empty block tag means sing-box reject action
+func PresetOutbounds() (map[string]string, error) {
+	outbounds := map[string]string{"proxy": builds.Config.XrayHelper.ProxyTag}
+	switch builds.Config.XrayHelper.CoreType {
+	case "mihomo":
+		outbounds["direct"], outbounds["block"] = "DIRECT", "REJECT"
+		return outbounds, nil
+	case "xray", "sing-box":
+	default:
+		return nil, e.New("preset is not supported by core type " + builds.Config.XrayHelper.CoreType).WithPrefix(tagPreset)
+	}
+	kindName, direct, block := "protocol", "freedom", "blackhole"
+	if builds.Config.XrayHelper.CoreType == "sing-box" {
+		kindName, direct, block = "type", "direct", "block"
+	}
+	read := func(c []byte) (bool, []byte, error) {
+		var jsonMap serial.OrderedMap
+		if err := json.Unmarshal(c, &jsonMap); err != nil {
+			return false, nil, e.New("json unmarshal failed, " + err.Error()).WithPrefix(tagPreset)
+		}
+		o, ok := jsonMap.Get("outbounds")
+		if !ok {
+			return false, nil, e.New("cannot find outbounds from your config").WithPrefix(tagPreset)
+		}
+		outboundsArray, _ := o.Value.(serial.OrderedArray)
+		for _, outbound := range outboundsArray {
+			outboundMap, ok := outbound.(serial.OrderedMap)
+			if !ok {
+				continue
+			}
+			kind, _ := outboundMap.Get(kindName)
+			tag, _ := outboundMap.Get("tag")
+			if kind == nil || tag == nil {
+				continue
+			}
+			for name, want := range map[string]string{"direct": direct, "block": block} {
+				if _, found := outbounds[name]; !found && serial.ToString(kind.Value) == want {
+					outbounds[name] = serial.ToString(tag.Value)
+				}
+			}
+		}
+		return false, nil, nil
+	}
+	if err := common.HandleCoreConfDir(read); err != nil {
+		return nil, err
+	}
+	if _, ok := outbounds["direct"]; !ok {
+		return nil, e.New("cannot find " + direct + " outbound from your config").WithPrefix(tagPreset)
+	}
+	if _, ok := outbounds["block"]; !ok {
+		if builds.Config.XrayHelper.CoreType == "xray" {
+			return nil, e.New("cannot find " + block + " outbound from your config").WithPrefix(tagPreset)
+		}
+		outbounds["block"] = ""
+	}
+	return outbounds, nil
+}
+
+// TranslatePreset translate preset into the rules of core type, and the geosite and geoip categories
+// which should be registered as sing-box rule-set, like geosite:cn
+func TranslatePreset(coreType string, preset *Preset, outbounds map[string]string) (serial.OrderedArray, []string, error) {
+	var (
+		rules      serial.OrderedArray
+		categories []string
+	)
+	for i, r := range preset.Rules {
+		outbound, ok := outbounds[r.Outbound]
+		if !ok {
+			return nil, nil, e.New("preset " + preset.Name + " rule " + strconv.Itoa(i) + " has unknown outbound " + r.Outbound + ", available outbound [proxy|direct|block]").WithPrefix(tagPreset)
+		}
+		var (
+			translated serial.OrderedArray
+			err        error
+		)
+		switch coreType {
+		case "xray":
+			translated = translateXrayRule(r, outbound)
+		case "sing-box":
+			var cats []string
+			translated, cats, err = translateSingboxRule(r, outbound)
+			categories = append(categories, cats...)
+		case "mihomo":
+			translated, err = translateMihomoRule(r, outbound)
+		default:
+			return nil, nil, e.New("preset is not supported by core type " + coreType).WithPrefix(tagPreset)
+		}
+		if err != nil {
+			return nil, nil, e.New("preset "+preset.Name+" rule "+strconv.Itoa(i)+", ", err).WithPrefix(tagPreset)
+		}
+		rules = append(rules, translated...)
+	}
+	return rules, categories, nil
+}
+
+// translateXrayRule domain and ip are in separate rules, since the conditions of xray rule are all required
+func translateXrayRule(r PresetRule, outbound string) (rules serial.OrderedArray) {
+	newRule := func(key string, values []string) serial.OrderedMap {
+		var ruleMap serial.OrderedMap
+		if len(values) > 0 {
+			var arr serial.OrderedArray
+			for _, v := range values {
+				arr = append(arr, v)
+			}
+			ruleMap.Set(key, arr)
+		}
+		if len(r.Port) > 0 {
+			ruleMap.Set("port", r.Port)
+		}
+		if len(r.Network) > 0 {
+			ruleMap.Set("network", r.Network)
+		}
+		ruleMap.Set("outboundTag", outbound)
+		return ruleMap
+	}
+	if len(r.Domain) > 0 {
+		rules = append(rules, newRule("domain", r.Domain))
+	}
+	if len(r.IP) > 0 {
+		rules = append(rules, newRule("ip", r.IP))
+	}
+	if len(r.Domain) == 0 && len(r.IP) == 0 {
+		rules = append(rules, newRule("", nil))
+	}
+	return
+}
+
+func translateSingboxRule(r PresetRule, outbound string) (serial.OrderedArray, []string, error) {
+	fields := make(map[string]serial.OrderedArray)
+	var (
+		order      []string
+		categories []string
+		private    bool
+	)
+	add := func(key string, value any) {
+		if _, ok := fields[key]; !ok {
+			order = append(order, key)
+		}
+		fields[key] = append(fields[key], value)
+	}
+	for _, d := range r.Domain {
+		prefix, value, found := strings.Cut(d, ":")
+		if !found {
+			prefix, value = "keyword", d
+		}
+		switch prefix {
+		case "geosite":
+			categories = append(categories, d)
+			add("rule_set", "geosite-"+strings.ToLower(value))
+		case "domain":
+			add("domain_suffix", value)
+		case "full":
+			add("domain", value)
+		case "keyword":
+			add("domain_keyword", value)
+		case "regexp":
+			add("domain_regex", value)
+		default:
+			return nil, nil, e.New("domain " + d + " is not supported by sing-box")
+		}
+	}
+	for _, ip := range r.IP {
+		if code, found := strings.CutPrefix(ip, "geoip:"); found {
+			if strings.HasPrefix(code, "!") {
+				return nil, nil, e.New("ip " + ip + " is not supported by sing-box")
+			}
+			if strings.EqualFold(code, "private") {
+				private = true
+				continue
+			}
+			categories = append(categories, ip)
+			add("rule_set", "geoip-"+strings.ToLower(code))
+		} else if _, ok := parsePresetCidr(ip); ok {
+			add("ip_cidr", ip)
+		} else {
+			return nil, nil, e.New("invalid ip " + ip)
+		}
+	}
+	var ruleMap serial.OrderedMap
+	for _, key := range order {
+		ruleMap.Set(key, fields[key])
+	}
+	if private {
+		ruleMap.Set("ip_is_private", true)
+	}
+	if len(r.Port) > 0 {
+		var ports, portRanges serial.OrderedArray
+		for _, p := range strings.Split(r.Port, ",") {
+			p = strings.TrimSpace(p)
+			if from, to, found := strings.Cut(p, "-"); found {
+				portRanges = append(portRanges, from+":"+to)
+			} else if port, err := strconv.Atoi(p); err == nil {
+				ports = append(ports, port)
+			} else {
+				return nil, nil, e.New("invalid port " + p)
+			}
+		}
+		if len(ports) > 0 {
+			ruleMap.Set("port", ports)
+		}
+		if len(portRanges) > 0 {
+			ruleMap.Set("port_range", portRanges)
+		}
+	}
+	if len(r.Network) > 0 && r.Network != "tcp,udp" {
+		ruleMap.Set("network", r.Network)
+	}
+	if len(outbound) > 0 {
+		ruleMap.Set("outbound", outbound)
+	} else {
+		ruleMap.Set("action", "reject")
+	}
+	return serial.OrderedArray{ruleMap}, categories, nil
+}
+
+// translateMihomoRule every domain and ip is a rule, port and network are joined by AND
+func translateMihomoRule(r PresetRule, outbound string) (serial.OrderedArray, error) {
+	var conditions, extra []string
+	for _, d := range r.Domain {
+		prefix, value, found := strings.Cut(d, ":")
+		if !found {
+			prefix, value = "keyword", d
+		}
+		switch prefix {
+		case "geosite":
+			conditions = append(conditions, "GEOSITE,"+value)
+		case "domain":
+			conditions = append(conditions, "DOMAIN-SUFFIX,"+value)
+		case "full":
+			conditions = append(conditions, "DOMAIN,"+value)
+		case "keyword":
+			conditions = append(conditions, "DOMAIN-KEYWORD,"+value)
+		case "regexp":
+			conditions = append(conditions, "DOMAIN-REGEX,"+value)
+		default:
+			return nil, e.New("domain " + d + " is not supported by mihomo")
+		}
+	}
+	for _, ip := range r.IP {
+		if code, found := strings.CutPrefix(ip, "geoip:"); found {
+			if strings.HasPrefix(code, "!") {
+				return nil, e.New("ip " + ip + " is not supported by mihomo")
+			}
+			if strings.EqualFold(code, "private") {
+				code = "LAN"
+			}
+			conditions = append(conditions, "GEOIP,"+strings.ToUpper(code))
+		} else if cidr, ok := parsePresetCidr(ip); ok {
+			if cidr.Addr().Is4() {
+				conditions = append(conditions, "IP-CIDR,"+cidr.String())
+			} else {
+				conditions = append(conditions, "IP-CIDR6,"+cidr.String())
+			}
+		} else {
+			return nil, e.New("invalid ip " + ip)
+		}
+	}
+	if len(r.Port) > 0 {
+		extra = append(extra, "DST-PORT,"+strings.ReplaceAll(strings.ReplaceAll(r.Port, " ", ""), ",", "/"))
+	}
+	if len(r.Network) > 0 && r.Network != "tcp,udp" {
+		extra = append(extra, "NETWORK,"+strings.ToUpper(r.Network))
+	}
+	if len(conditions) == 0 {
+		if len(extra) == 0 {
+			return nil, e.New("rule does not have any condition")
+		}
+		conditions, extra = extra[:1], extra[1:]
+	}
+	var rules serial.OrderedArray
+	for _, condition := range conditions {
+		if len(extra) == 0 {
+			rules = append(rules, condition+","+outbound)
+			continue
+		}
+		and := "AND,((" + condition + ")"
+		for _, c := range extra {
+			and += ",(" + c + ")"
+		}
+		rules = append(rules, and+"),"+outbound)
+	}
+	return rules, nil
+}
+
+func parsePresetCidr(text string) (netip.Prefix, bool) {
+	if cidr, err := netip.ParsePrefix(text); err == nil {
+		return cidr, true
+	}
+	if ip, err := netip.ParseAddr(text); err == nil {
+		return netip.PrefixFrom(ip, ip.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// ApplyPreset put the translated rules of preset ahead of the current rules, the rules applied by
+// the previous version of preset are replaced in place, then sync rules to core config
+func ApplyPreset(name string, version int, rules serial.OrderedArray) error {
+	if err := states.LoadPreset(); err != nil {
+		return err
+	}
+	loadRule()
+	index := removePresetRules(name)
+	if index < 0 {
+		index = 0
+	}
+	var applied []string
+	for _, r := range rules {
+		marshal, err := json.Marshal(r)
+		if err != nil {
+			return e.New("marshal rule failed, ", err).WithPrefix(tagPreset)
+		}
+		applied = append(applied, string(marshal))
+	}
+	rule = append(rule[:index], append(append(serial.OrderedArray{}, rules...), rule[index:]...)...)
+	if err := ApplyRule(); err != nil {
+		return err
+	}
+	states.Preset[name] = states.AppliedPreset{Version: version, Rules: applied}
+	return states.SavePreset()
+}
+
+// RemovePreset delete the rules applied by preset, then sync rules to core config
+func RemovePreset(name string) error {
+	if err := states.LoadPreset(); err != nil {
+		return err
+	}
+	if _, ok := states.Preset[name]; !ok {
+		return e.New("preset " + name + " is not applied").WithPrefix(tagPreset)
+	}
+	loadRule()
+	removePresetRules(name)
+	if err := ApplyRule(); err != nil {
+		return err
+	}
+	delete(states.Preset, name)
+	return states.SavePreset()
+}
+
+// removePresetRules delete the rules applied by preset from loaded rules, return the index of the first removed rule, -1 if none
+func removePresetRules(name string) int {
+	applied, ok := states.Preset[name]
+	if !ok {
+		return -1
+	}
+	remain := make(map[string]int)
+	for _, r := range applied.Rules {
+		remain[r]++
+	}
+	first := -1
+	for i := 0; i < len(rule); i++ {
+		marshal, err := json.Marshal(rule[i])
+		if err != nil || remain[string(marshal)] == 0 {
+			continue
+		}
+		remain[string(marshal)]--
+		if first < 0 {
+			first = i
+		}
+		rule = append(rule[:i], rule[i+1:]...)
+		i--
+	}
+	return first
+}
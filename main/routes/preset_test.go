@@ -0,0 +1,54 @@
+package routes_test
+
+import (
+	"XrayHelper/main/routes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTranslatePreset(t *testing.T) {
+	preset := &routes.Preset{Name: "test", Version: 1, Rules: []routes.PresetRule{
+		{Domain: []string{"geosite:cn", "domain:example.com"}, IP: []string{"geoip:private", "10.0.0.0/8"}, Port: "443,8000-9000", Outbound: "direct"},
+		{Network: "udp", Outbound: "block"},
+	}}
+	outbounds := map[string]string{"proxy": "proxy", "direct": "direct", "block": ""}
+	tests := []struct {
+		coreType   string
+		want       string
+		categories []string
+	}{
+		{"xray", `[{"domain":["geosite:cn","domain:example.com"],"port":"443,8000-9000","outboundTag":"direct"},` +
+			`{"ip":["geoip:private","10.0.0.0/8"],"port":"443,8000-9000","outboundTag":"direct"},` +
+			`{"network":"udp","outboundTag":""}]`, nil},
+		{"sing-box", `[{"rule_set":["geosite-cn"],"domain_suffix":["example.com"],"ip_cidr":["10.0.0.0/8"],"ip_is_private":true,"port":[443],"port_range":["8000:9000"],"outbound":"direct"},` +
+			`{"network":"udp","action":"reject"}]`, []string{"geosite:cn"}},
+	}
+	for _, test := range tests {
+		rules, categories, err := routes.TranslatePreset(test.coreType, preset, outbounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshal, _ := json.Marshal(rules)
+		if string(marshal) != test.want {
+			t.Errorf("%s: expect %s, got %s", test.coreType, test.want, marshal)
+		}
+		if !reflect.DeepEqual(categories, test.categories) {
+			t.Errorf("%s: expect categories %v, got %v", test.coreType, test.categories, categories)
+		}
+	}
+	outbounds = map[string]string{"proxy": "PROXY", "direct": "DIRECT", "block": "REJECT"}
+	rules, _, err := routes.TranslatePreset("mihomo", preset, outbounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshal, _ := json.Marshal(rules)
+	want := `["AND,((GEOSITE,cn),(DST-PORT,443/8000-9000)),DIRECT","AND,((DOMAIN-SUFFIX,example.com),(DST-PORT,443/8000-9000)),DIRECT",` +
+		`"AND,((GEOIP,LAN),(DST-PORT,443/8000-9000)),DIRECT","AND,((IP-CIDR,10.0.0.0/8),(DST-PORT,443/8000-9000)),DIRECT","NETWORK,UDP,REJECT"]`
+	if string(marshal) != want {
+		t.Errorf("mihomo: expect %s, got %s", want, marshal)
+	}
+	if _, _, err := routes.TranslatePreset("xray", &routes.Preset{Rules: []routes.PresetRule{{Outbound: "unknown"}}}, outbounds); err == nil {
+		t.Error("expect error for unknown outbound")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"XrayHelper/main/builds"
 	"XrayHelper/main/common"
 	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
 	"XrayHelper/main/serial"
 	"XrayHelper/main/shareurls"
+	"XrayHelper/main/states"
 	"XrayHelper/main/switches"
 	"encoding/json"
 	"strconv"
@@ -21,6 +23,24 @@ func loadRule() {
 	if len(rule) > 0 {
 		return
 	}
+	if isYamlCore() {
+		var (
+			value any
+			err   error
+		)
+		switch builds.Config.XrayHelper.CoreType {
+		case "mihomo":
+			value, err = loadYamlValue("", "rules")
+		case "hysteria2":
+			value, err = loadYamlValue("acl", "inline")
+		}
+		if err != nil {
+			log.HandleDebug(err)
+			return
+		}
+		rule, _ = value.(serial.OrderedArray)
+		return
+	}
 	read := func(c []byte) (bool, []byte, error) {
 		var jsonMap serial.OrderedMap
 		err := json.Unmarshal(c, &jsonMap)
@@ -38,10 +58,11 @@ func loadRule() {
 			}
 		case "sing-box":
 			if route, ok := jsonMap.Get("route"); ok {
-				routeMap := route.Value.(serial.OrderedMap)
-				if rules, ok := routeMap.Get("rules"); ok {
-					rule = rules.Value.(serial.OrderedArray)
-					return false, nil, nil
+				if routeMap, ok := route.Value.(serial.OrderedMap); ok {
+					if rules, ok := routeMap.Get("rules"); ok {
+						rule, _ = rules.Value.(serial.OrderedArray)
+						return false, nil, nil
+					}
 				}
 			}
 		}
@@ -50,9 +71,20 @@ func loadRule() {
 	_ = common.HandleCoreConfDir(read)
 }
 
-// AddRule add a rule
-func AddRule(r *serial.OrderedMap) bool {
+// ClearRule drop the loaded rules, they are loaded from core config again when used
+func ClearRule() {
+	rule = nil
+}
+
+// AddRule add a rule, mihomo and hysteria2 rules are string, mihomo rule is added before the final MATCH rule
+func AddRule[T any](r *T) bool {
 	loadRule()
+	if builds.Config.XrayHelper.CoreType == "mihomo" && len(rule) > 0 {
+		if last, ok := rule[len(rule)-1].(string); ok && strings.HasPrefix(strings.ToUpper(strings.TrimSpace(last)), "MATCH,") {
+			rule = append(rule[:len(rule)-1], *r, last)
+			return true
+		}
+	}
 	rule = append(rule, *r)
 	return true
 }
@@ -67,8 +99,8 @@ func DeleteRule(index int) bool {
 	return false
 }
 
-// SetRule replace a rule
-func SetRule(index int, r *serial.OrderedMap) bool {
+// SetRule replace a rule, mihomo and hysteria2 rules are string
+func SetRule[T any](index int, r *T) bool {
 	loadRule()
 	if index >= 0 && index < len(rule) {
 		rule[index] = *r
@@ -97,6 +129,18 @@ func GetRule() serial.OrderedArray {
 
 // ApplyRule sync rules to core config
 func ApplyRule() error {
+	if err := validateRule(); err != nil {
+		return err
+	}
+	switch builds.Config.XrayHelper.CoreType {
+	case "mihomo":
+		return applyYamlValue("", "rules", rule)
+	case "hysteria2":
+		if _, err := loadYamlValue("acl", "file"); err == nil {
+			return e.New("hysteria2 acl file is used, cannot apply inline rules").WithPrefix(tagRule)
+		}
+		return applyYamlValue("acl", "inline", rule)
+	}
 	if err := replaceOutbounds(); err != nil {
 		return err
 	}
@@ -143,23 +187,66 @@ func ApplyRule() error {
 	return common.HandleCoreConfDir(replace)
 }
 
-func replaceOutbounds() error {
-	getOutBoundTags := func() (tags []string) {
-		var tagName = "outboundTag"
-		switch builds.Config.XrayHelper.CoreType {
-		case "xray":
-			tagName = "outboundTag"
-		case "sing-box":
-			tagName = "outbound"
+// ruleOutboundTags get the outbound tags of rules
+func ruleOutboundTags() (tags []string) {
+	var tagName = "outboundTag"
+	if builds.Config.XrayHelper.CoreType == "sing-box" {
+		tagName = "outbound"
+	}
+	for _, r := range rule {
+		ruleMap := r.(serial.OrderedMap)
+		if tag, ok := ruleMap.Get(tagName); ok {
+			tags = append(tags, tag.Value.(string))
 		}
-		for _, r := range rule {
-			ruleMap := r.(serial.OrderedMap)
-			if tag, ok := ruleMap.Get(tagName); ok {
-				tags = append(tags, tag.Value.(string))
+	}
+	return
+}
+
+// selectorMembers get the members of sing-box selectors
+func selectorMembers(outboundsArray serial.OrderedArray) (tags []string) {
+	for _, outbound := range outboundsArray {
+		if outboundMap, ok := outbound.(serial.OrderedMap); ok {
+			if members, ok := outboundMap.Get("outbounds"); ok {
+				if membersArray, ok := members.Value.(serial.OrderedArray); ok {
+					for _, member := range membersArray {
+						if tag, ok := member.(string); ok {
+							tags = append(tags, tag)
+						}
+					}
+				}
 			}
 		}
-		return
 	}
+	return
+}
+
+// ReferencedTags get the outbound tags referenced by rules and sing-box selectors, mihomo and hysteria2 are not supported
+func ReferencedTags() ([]string, error) {
+	if isYamlCore() {
+		return nil, nil
+	}
+	loadRule()
+	tags := ruleOutboundTags()
+	read := func(c []byte) (bool, []byte, error) {
+		var jsonMap serial.OrderedMap
+		if err := json.Unmarshal(c, &jsonMap); err != nil {
+			return false, nil, e.New("json unmarshal failed, " + err.Error()).WithPrefix(tagRule)
+		}
+		if outbounds, ok := jsonMap.Get("outbounds"); ok {
+			if outboundsArray, ok := outbounds.Value.(serial.OrderedArray); ok {
+				tags = append(tags, selectorMembers(outboundsArray)...)
+			}
+			return false, nil, nil
+		}
+		return false, nil, e.New("cannot found outbounds from your config").WithPrefix(tagRule)
+	}
+	if err := common.HandleCoreConfDir(read); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func replaceOutbounds() error {
 	replace := func(c []byte) (bool, []byte, error) {
 		s, err := switches.NewSwitch(builds.Config.XrayHelper.CoreType)
 		if err != nil {
@@ -172,10 +259,13 @@ func replaceOutbounds() error {
 		}
 		if outbounds, ok := jsonMap.Get("outbounds"); ok {
 			outboundsArray := outbounds.Value.(serial.OrderedArray)
+			// nodes in sing-box selector should be kept as well
+			tags := append(ruleOutboundTags(), selectorMembers(outboundsArray)...)
 			for i := 0; i < len(outboundsArray); i++ {
 				outboundMap := outboundsArray[i].(serial.OrderedMap)
 				if tag, ok := outboundMap.Get("tag"); ok {
-					if strings.HasPrefix(tag.Value.(string), "xrayhelper") {
+					// the nodes of group and chain are managed by switch
+					if t := tag.Value.(string); strings.HasPrefix(t, "xrayhelper") && !strings.HasPrefix(t, "xrayhelpergroup") && !strings.HasPrefix(t, "xrayhelperchain") {
 						outboundsArray = append(outboundsArray[:i], outboundsArray[i+1:]...)
 						i--
 					}
@@ -183,7 +273,12 @@ func replaceOutbounds() error {
 			}
 			// collect
 			var subscribe, custom []int
-			for _, tag := range getOutBoundTags() {
+			collected := make(map[string]bool)
+			for _, tag := range tags {
+				if collected[tag] {
+					continue
+				}
+				collected[tag] = true
 				if strings.HasPrefix(tag, "xrayhelper-") {
 					if index, err := strconv.Atoi(strings.TrimPrefix(tag, "xrayhelper-")); err == nil {
 						subscribe = append(subscribe, index)
@@ -194,21 +289,35 @@ func replaceOutbounds() error {
 					}
 				}
 			}
+			routed := make(map[string]states.Node)
 			for _, i := range subscribe {
 				tag := "xrayhelper-" + strconv.Itoa(i)
-				shareurl := s.Choose(false, i).(shareurls.ShareUrl)
-				if o, err := shareurl.ToOutboundWithTag(builds.Config.XrayHelper.CoreType, tag); err == nil {
-					outboundsArray = append(outboundsArray, o)
+				if shareurl, ok := s.Choose(false, i).(shareurls.ShareUrl); ok {
+					if o, err := shareurl.ToOutboundWithTag(builds.Config.XrayHelper.CoreType, tag); err == nil {
+						outboundsArray = append(outboundsArray, o)
+						routed[tag] = states.Node{Id: shareurl.GetNodeInfo().Id, Custom: false, Index: i}
+					}
 				}
 			}
 			s.Clear()
 			for _, i := range custom {
 				tag := "xrayhelpercustom-" + strconv.Itoa(i)
-				shareurl := s.Choose(true, i).(shareurls.ShareUrl)
-				if o, err := shareurl.ToOutboundWithTag(builds.Config.XrayHelper.CoreType, tag); err == nil {
-					outboundsArray = append(outboundsArray, o)
+				if shareurl, ok := s.Choose(true, i).(shareurls.ShareUrl); ok {
+					if o, err := shareurl.ToOutboundWithTag(builds.Config.XrayHelper.CoreType, tag); err == nil {
+						outboundsArray = append(outboundsArray, o)
+						routed[tag] = states.Node{Id: shareurl.GetNodeInfo().Id, Custom: true, Index: i}
+					}
 				}
 			}
+			s.Clear()
+			// persist routed nodes, so that they can be re-resolved after subscribe refreshed
+			if err := states.LoadSwitch(); err != nil {
+				log.HandleDebug(err)
+			}
+			states.Switch.Routes = routed
+			if err := states.SaveSwitch(); err != nil {
+				log.HandleDebug(err)
+			}
 			// replace
 			jsonMap.Set("outbounds", outboundsArray)
 			// marshal
@@ -222,3 +331,82 @@ func replaceOutbounds() error {
 	}
 	return common.HandleCoreConfDir(replace)
 }
+
+// ReplaceOutboundTag replace the outbound tags referenced by rules and sing-box selectors, then sync rules to core config
+func ReplaceOutboundTag(replace map[string]string) error {
+	loadRule()
+	var tagName = "outboundTag"
+	if builds.Config.XrayHelper.CoreType == "sing-box" {
+		tagName = "outbound"
+	}
+	for _, r := range rule {
+		ruleMap := r.(serial.OrderedMap)
+		if tag, ok := ruleMap.Get(tagName); ok {
+			if newTag, ok := replace[serial.ToString(tag.Value)]; ok {
+				ruleMap.Set(tagName, newTag)
+			}
+		}
+	}
+	// validate before the selectors are written, nothing is changed if the rules cannot be applied
+	if err := validateRule(); err != nil {
+		ClearRule()
+		return err
+	}
+	replaceSelector := func(c []byte) (bool, []byte, error) {
+		var jsonMap serial.OrderedMap
+		err := json.Unmarshal(c, &jsonMap)
+		if err != nil {
+			return false, nil, e.New("json unmarshal failed, " + err.Error()).WithPrefix(tagRule)
+		}
+		if outbounds, ok := jsonMap.Get("outbounds"); ok {
+			outboundsArray := outbounds.Value.(serial.OrderedArray)
+			for i, outbound := range outboundsArray {
+				outboundMap, ok := outbound.(serial.OrderedMap)
+				if !ok {
+					continue
+				}
+				// a selector cannot contain itself, the member replaced by its own tag is removed
+				var selectorTag string
+				if tag, ok := outboundMap.Get("tag"); ok {
+					selectorTag = serial.ToString(tag.Value)
+				}
+				if members, ok := outboundMap.Get("outbounds"); ok {
+					if membersArray, ok := members.Value.(serial.OrderedArray); ok {
+						var replaced serial.OrderedArray
+						for _, member := range membersArray {
+							if newTag, ok := replace[serial.ToString(member)]; ok {
+								if newTag == selectorTag {
+									continue
+								}
+								member = newTag
+							}
+							replaced = append(replaced, member)
+						}
+						outboundMap.Set("outbounds", replaced)
+					}
+				}
+				if defaultTag, ok := outboundMap.Get("default"); ok {
+					if newTag, ok := replace[serial.ToString(defaultTag.Value)]; ok {
+						if newTag == selectorTag {
+							outboundMap.Delete("default")
+						} else {
+							outboundMap.Set("default", newTag)
+						}
+					}
+				}
+				outboundsArray[i] = outboundMap
+			}
+			// marshal
+			marshal, err := json.MarshalIndent(jsonMap, "", "    ")
+			if err != nil {
+				return false, nil, e.New("marshal config json failed, ", err).WithPrefix(tagRule)
+			}
+			return true, marshal, nil
+		}
+		return false, nil, e.New("cannot found outbounds from your config").WithPrefix(tagRule)
+	}
+	if err := common.HandleCoreConfDir(replaceSelector); err != nil {
+		return err
+	}
+	return ApplyRule()
+}
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"XrayHelper/main/builds"
 	"XrayHelper/main/common"
 	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
 	"XrayHelper/main/serial"
 	"encoding/json"
 )
@@ -16,6 +18,25 @@ func loadRuleset() {
 	if len(ruleset) > 0 {
 		return
 	}
+	if builds.Config.XrayHelper.CoreType == "mihomo" {
+		value, err := loadYamlValue("", "rule-providers")
+		if err != nil {
+			log.HandleDebug(err)
+			return
+		}
+		// flatten rule-providers map into array, the key becomes name field
+		if providers, ok := value.(serial.OrderedMap); ok {
+			for _, provider := range providers.Values {
+				var providerMap serial.OrderedMap
+				providerMap.Set("name", provider.Key)
+				if m, ok := provider.Value.(serial.OrderedMap); ok {
+					providerMap.Values = append(providerMap.Values, m.Values...)
+				}
+				ruleset = append(ruleset, providerMap)
+			}
+		}
+		return
+	}
 	read := func(c []byte) (bool, []byte, error) {
 		var jsonMap serial.OrderedMap
 		err := json.Unmarshal(c, &jsonMap)
@@ -69,6 +90,24 @@ func GetRuleset() serial.OrderedArray {
 
 // ApplyRuleset sync ruleset to core config
 func ApplyRuleset() error {
+	if builds.Config.XrayHelper.CoreType == "mihomo" {
+		var providers serial.OrderedMap
+		for _, r := range ruleset {
+			providerMap, _ := r.(serial.OrderedMap)
+			name, ok := providerMap.Get("name")
+			if !ok || len(serial.ToString(name.Value)) == 0 {
+				return e.New("rule-provider must have a name").WithPrefix(tagRuleset)
+			}
+			var provider serial.OrderedMap
+			for _, val := range providerMap.Values {
+				if val.Key != "name" {
+					provider.Values = append(provider.Values, val)
+				}
+			}
+			providers.Set(serial.ToString(name.Value), provider)
+		}
+		return applyYamlValue("", "rule-providers", providers)
+	}
 	replace := func(c []byte) (bool, []byte, error) {
 		var jsonMap serial.OrderedMap
 		err := json.Unmarshal(c, &jsonMap)
@@ -77,7 +116,7 @@ func ApplyRuleset() error {
 		}
 		if routeMap, ok := jsonMap.Get("route"); ok {
 			route := routeMap.Value.(serial.OrderedMap)
-			if _, ok := route.Get("rule_set"); ok {
+			if _, ok := route.Get("rule_set"); ok || len(ruleset) > 0 {
 				route.Set("rule_set", ruleset)
 			}
 			// replace
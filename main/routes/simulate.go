@@ -0,0 +1,482 @@
+package routes
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/geodata"
+	"XrayHelper/main/serial"
+	"encoding/json"
+	"net/netip"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const tagSimulate = "simulate"
+
+// Target the connection to simulate routing, Domain or IP should be set
+type Target struct {
+	Domain  string
+	IP      netip.Addr
+	Port    int
+	Network string
+	Inbound string
+}
+
+// Decision the result of routing simulation, Index is -1 if no rule matched,
+// Reason is the condition matched, Skipped is the rules cannot be evaluated with their reasons
+type Decision struct {
+	Index    int
+	Rule     serial.OrderedMap
+	Reason   string
+	Outbound string
+	Skipped  map[int]string
+}
+
+// SimulateRoute evaluate the rules of current core config in order
+func SimulateRoute(target *Target) (*Decision, error) {
+	loadRule()
+	decision, err := Simulate(builds.Config.XrayHelper.CoreType, rule, target)
+	if err != nil {
+		return nil, err
+	}
+	if decision.Index < 0 {
+		decision.Outbound = defaultOutbound()
+	}
+	return decision, nil
+}
+
+// Simulate evaluate the rules in order, return the first matched one
+func Simulate(coreType string, rules serial.OrderedArray, target *Target) (*Decision, error) {
+	if coreType != "xray" && coreType != "sing-box" {
+		return nil, e.New("route simulation not support core type " + coreType).WithPrefix(tagSimulate)
+	}
+	decision := &Decision{Index: -1, Skipped: make(map[int]string)}
+	geo := &geoCache{geoip: make(map[string][]*geodata.GeoIP), geosite: make(map[string][]*geodata.GeoSite)}
+	for i, r := range rules {
+		ruleMap, ok := r.(serial.OrderedMap)
+		if !ok {
+			continue
+		}
+		var (
+			matched bool
+			reason  string
+			err     error
+		)
+		if coreType == "xray" {
+			matched, reason, err = matchXrayRule(ruleMap, target, geo)
+		} else {
+			matched, reason, err = matchSingboxRule(ruleMap, target, geo)
+		}
+		if err != nil {
+			decision.Skipped[i] = err.Error()
+			continue
+		}
+		if matched && coreType == "sing-box" && !finalAction(ruleMap) {
+			continue
+		}
+		if matched {
+			decision.Index = i
+			decision.Rule = ruleMap
+			decision.Reason = reason
+			decision.Outbound = ruleOutbound(coreType, ruleMap)
+			return decision, nil
+		}
+	}
+	return decision, nil
+}
+
+// finalAction check whether the action of sing-box rule stops matching, sniff and resolve actions continue matching
+func finalAction(ruleMap serial.OrderedMap) bool {
+	if action, ok := ruleMap.Get("action"); ok {
+		switch serial.ToString(action.Value) {
+		case "sniff", "resolve", "route-options":
+			return false
+		}
+	}
+	return true
+}
+
+// ruleOutbound get the outbound selected by rule
+func ruleOutbound(coreType string, ruleMap serial.OrderedMap) string {
+	if coreType == "xray" {
+		if tag, ok := ruleMap.Get("outboundTag"); ok {
+			return serial.ToString(tag.Value)
+		}
+		if tag, ok := ruleMap.Get("balancerTag"); ok {
+			return "balancer:" + serial.ToString(tag.Value)
+		}
+		return ""
+	}
+	if tag, ok := ruleMap.Get("outbound"); ok {
+		return serial.ToString(tag.Value)
+	}
+	// sing-box rule actions, route is the default action
+	if action, ok := ruleMap.Get("action"); ok {
+		return "action:" + serial.ToString(action.Value)
+	}
+	return ""
+}
+
+// defaultOutbound get the outbound used when no rule matched, the first outbound or sing-box route.final
+func defaultOutbound() (outbound string) {
+	read := func(c []byte) (bool, []byte, error) {
+		var jsonMap serial.OrderedMap
+		if err := json.Unmarshal(c, &jsonMap); err != nil {
+			return false, nil, e.New("json unmarshal failed, " + err.Error()).WithPrefix(tagSimulate)
+		}
+		if route, ok := jsonMap.Get("route"); ok {
+			if routeMap, ok := route.Value.(serial.OrderedMap); ok {
+				if final, ok := routeMap.Get("final"); ok {
+					outbound = serial.ToString(final.Value)
+					return false, nil, nil
+				}
+			}
+		}
+		if outbounds, ok := jsonMap.Get("outbounds"); ok {
+			if outboundsArray, ok := outbounds.Value.(serial.OrderedArray); ok && len(outboundsArray) > 0 {
+				if outboundMap, ok := outboundsArray[0].(serial.OrderedMap); ok {
+					if tag, ok := outboundMap.Get("tag"); ok {
+						outbound = serial.ToString(tag.Value)
+						return false, nil, nil
+					}
+				}
+			}
+		}
+		return false, nil, e.New("cannot find outbounds from your config").WithPrefix(tagSimulate)
+	}
+	_ = common.HandleCoreConfDir(read)
+	return
+}
+
+// matchXrayRule evaluate the conditions of xray routing rule, all conditions should be matched
+func matchXrayRule(ruleMap serial.OrderedMap, target *Target, geo *geoCache) (bool, string, error) {
+	var reasons []string
+	for _, cond := range ruleMap.Values {
+		var (
+			matched bool
+			reason  string
+			err     error
+		)
+		switch cond.Key {
+		case "type", "outboundTag", "balancerTag", "ruleTag", "domainMatcher":
+			continue
+		case "domain", "domains":
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return matchXrayDomain(entry, target.Domain, geo)
+			})
+		case "ip":
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return matchXrayIP(entry, target.IP, geo)
+			})
+		case "port":
+			matched, reason, err = matchAny(strings.Split(serial.ToString(cond.Value), ","), func(entry string) (bool, error) {
+				return matchPortRange(entry, "-", target.Port)
+			})
+		case "network":
+			matched, reason, err = matchAny(strings.Split(serial.ToString(cond.Value), ","), func(entry string) (bool, error) {
+				return strings.TrimSpace(entry) == target.Network, nil
+			})
+		case "inboundTag":
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return entry == target.Inbound, nil
+			})
+		default:
+			return false, "", e.New("unsupported condition " + cond.Key).WithPrefix(tagSimulate)
+		}
+		if err != nil {
+			return false, "", err
+		}
+		if !matched {
+			return false, "", nil
+		}
+		reasons = append(reasons, cond.Key+" "+reason)
+	}
+	if len(reasons) == 0 {
+		return false, "", e.New("rule has no condition").WithPrefix(tagSimulate)
+	}
+	return true, strings.Join(reasons, ", "), nil
+}
+
+// matchSingboxRule evaluate the conditions of sing-box route rule, the domain and ip conditions are matched if any of them matched,
+// so are port and port_range
+func matchSingboxRule(ruleMap serial.OrderedMap, target *Target, geo *geoCache) (bool, string, error) {
+	var (
+		reasons      []string
+		hasAddress   bool
+		matchAddress string
+		hasPort      bool
+		matchPort    string
+		invert       bool
+		allMatched   = true
+	)
+	for _, cond := range ruleMap.Values {
+		var (
+			matched bool
+			reason  string
+			err     error
+			address bool
+			port    bool
+		)
+		switch cond.Key {
+		case "outbound", "action":
+			continue
+		case "invert":
+			invert = serial.ToString(cond.Value) == "true"
+			continue
+		case "domain":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return geodata.Domain{Type: geodata.Full, Value: entry}.Match(target.Domain) && len(target.Domain) > 0, nil
+			})
+		case "domain_suffix":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				domain := strings.ToLower(target.Domain)
+				entry = strings.ToLower(entry)
+				return len(domain) > 0 && (domain == strings.TrimPrefix(entry, ".") || strings.HasSuffix(domain, "."+strings.TrimPrefix(entry, "."))), nil
+			})
+		case "domain_keyword":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return len(target.Domain) > 0 && strings.Contains(strings.ToLower(target.Domain), strings.ToLower(entry)), nil
+			})
+		case "domain_regex":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				re, err := regexp.Compile(entry)
+				if err != nil {
+					return false, e.New("invalid domain_regex "+entry+", ", err).WithPrefix(tagSimulate)
+				}
+				return len(target.Domain) > 0 && re.MatchString(target.Domain), nil
+			})
+		case "geosite":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return matchXrayDomain("geosite:"+entry, target.Domain, geo)
+			})
+		case "geoip":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return matchXrayIP("geoip:"+entry, target.IP, geo)
+			})
+		case "ip_cidr":
+			address = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return matchXrayIP(entry, target.IP, geo)
+			})
+		case "ip_is_private":
+			address = true
+			matched = target.IP.IsValid() && (target.IP.IsPrivate() || target.IP.IsLoopback() || target.IP.IsLinkLocalUnicast()) == (serial.ToString(cond.Value) == "true")
+		case "port", "port_range":
+			port = true
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return matchPortRange(entry, ":", target.Port)
+			})
+		case "network":
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return entry == target.Network, nil
+			})
+		case "inbound":
+			matched, reason, err = matchAny(stringList(cond.Value), func(entry string) (bool, error) {
+				return entry == target.Inbound, nil
+			})
+		default:
+			return false, "", e.New("unsupported condition " + cond.Key).WithPrefix(tagSimulate)
+		}
+		if err != nil {
+			return false, "", err
+		}
+		if address {
+			hasAddress = true
+			if matched && len(matchAddress) == 0 {
+				matchAddress = cond.Key + " " + reason
+			}
+		} else if port {
+			hasPort = true
+			if matched && len(matchPort) == 0 {
+				matchPort = cond.Key + " " + reason
+			}
+		} else if matched {
+			reasons = append(reasons, cond.Key+" "+reason)
+		} else {
+			allMatched = false
+		}
+	}
+	if hasPort {
+		if len(matchPort) == 0 {
+			allMatched = false
+		} else {
+			reasons = append([]string{matchPort}, reasons...)
+		}
+	}
+	if hasAddress {
+		if len(matchAddress) == 0 {
+			allMatched = false
+		} else {
+			reasons = append([]string{matchAddress}, reasons...)
+		}
+	}
+	if !hasAddress && !hasPort && len(reasons) == 0 && allMatched {
+		return false, "", e.New("rule has no condition").WithPrefix(tagSimulate)
+	}
+	if invert {
+		return !allMatched, "invert", nil
+	}
+	return allMatched, strings.Join(reasons, ", "), nil
+}
+
+// matchXrayDomain match domain with xray domain rule, like domain:, full:, regexp:, keyword:, geosite: or ext:
+func matchXrayDomain(entry string, domain string, geo *geoCache) (bool, error) {
+	if len(domain) == 0 {
+		return false, nil
+	}
+	prefix, value, found := strings.Cut(entry, ":")
+	if !found {
+		return geodata.Domain{Type: geodata.Plain, Value: entry}.Match(domain), nil
+	}
+	switch prefix {
+	case "domain":
+		return geodata.Domain{Type: geodata.RootDomain, Value: value}.Match(domain), nil
+	case "full":
+		return geodata.Domain{Type: geodata.Full, Value: value}.Match(domain), nil
+	case "keyword":
+		return geodata.Domain{Type: geodata.Plain, Value: value}.Match(domain), nil
+	case "regexp":
+		if _, err := regexp.Compile(value); err != nil {
+			return false, e.New("invalid regexp "+value+", ", err).WithPrefix(tagSimulate)
+		}
+		return geodata.Domain{Type: geodata.Regex, Value: value}.Match(domain), nil
+	case "dotless":
+		return !strings.Contains(domain, ".") && strings.Contains(domain, value), nil
+	case "geosite":
+		return geo.matchGeoSite("geosite.dat", value, domain)
+	case "ext":
+		file, code, _ := strings.Cut(value, ":")
+		return geo.matchGeoSite(file, code, domain)
+	default:
+		// the plain string contains colon
+		return geodata.Domain{Type: geodata.Plain, Value: entry}.Match(domain), nil
+	}
+}
+
+// matchXrayIP match ip with xray ip rule, like ip, cidr, geoip:, geoip:! or ext:
+func matchXrayIP(entry string, ip netip.Addr, geo *geoCache) (bool, error) {
+	if !ip.IsValid() {
+		return false, nil
+	}
+	ip = ip.Unmap()
+	if code, ok := strings.CutPrefix(entry, "geoip:"); ok {
+		return geo.matchGeoIP("geoip.dat", code, ip)
+	}
+	if value, ok := strings.CutPrefix(entry, "ext:"); ok {
+		file, code, _ := strings.Cut(value, ":")
+		return geo.matchGeoIP(file, code, ip)
+	}
+	if strings.Contains(entry, "/") {
+		cidr, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return false, e.New("invalid cidr "+entry+", ", err).WithPrefix(tagSimulate)
+		}
+		return cidr.Contains(ip), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return false, e.New("invalid ip "+entry+", ", err).WithPrefix(tagSimulate)
+	}
+	return addr.Unmap() == ip, nil
+}
+
+// matchPortRange match port with a port or port range, like 443 or 1000-2000
+func matchPortRange(entry string, sep string, port int) (bool, error) {
+	entry = strings.TrimSpace(entry)
+	from, to, found := strings.Cut(entry, sep)
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil && !(found && len(strings.TrimSpace(from)) == 0) {
+		return false, e.New("invalid port " + entry).WithPrefix(tagSimulate)
+	}
+	end := start
+	if found {
+		if len(strings.TrimSpace(to)) == 0 {
+			end = 65535
+		} else if end, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+			return false, e.New("invalid port " + entry).WithPrefix(tagSimulate)
+		}
+	}
+	return port > 0 && port >= start && port <= end, nil
+}
+
+// matchAny return the first matched entry
+func matchAny(entries []string, match func(entry string) (bool, error)) (bool, string, error) {
+	for _, entry := range entries {
+		matched, err := match(entry)
+		if err != nil {
+			return false, "", err
+		}
+		if matched {
+			return true, entry, nil
+		}
+	}
+	return false, "", nil
+}
+
+// stringList get the string list of condition, a single value is treated as a list
+func stringList(value any) []string {
+	var list []string
+	if arr, ok := value.(serial.OrderedArray); ok {
+		for _, v := range arr {
+			list = append(list, serial.ToString(v))
+		}
+		return list
+	}
+	return append(list, serial.ToString(value))
+}
+
+// geoCache the geodata files loaded from DataDir
+type geoCache struct {
+	geoip   map[string][]*geodata.GeoIP
+	geosite map[string][]*geodata.GeoSite
+}
+
+// matchGeoSite match domain with geosite category of file, code can have an attribute like cn@ads
+func (this *geoCache) matchGeoSite(file string, code string, domain string) (bool, error) {
+	list, ok := this.geosite[file]
+	if !ok {
+		var err error
+		if list, err = geodata.LoadGeoSite(path.Join(builds.Config.XrayHelper.DataDir, file)); err != nil {
+			return false, err
+		}
+		this.geosite[file] = list
+	}
+	code, attr, _ := strings.Cut(code, "@")
+	geosite := geodata.FindGeoSite(list, code)
+	if geosite == nil {
+		return false, e.New("cannot find geosite:" + code + " from " + file).WithPrefix(tagSimulate)
+	}
+	for _, d := range geosite.Domain {
+		if (len(attr) == 0 || d.HasAttribute(attr)) && d.Match(domain) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchGeoIP match ip with geoip category of file, code with prefix ! means not in the category
+func (this *geoCache) matchGeoIP(file string, code string, ip netip.Addr) (bool, error) {
+	list, ok := this.geoip[file]
+	if !ok {
+		var err error
+		if list, err = geodata.LoadGeoIP(path.Join(builds.Config.XrayHelper.DataDir, file)); err != nil {
+			return false, err
+		}
+		this.geoip[file] = list
+	}
+	code, reverse := strings.CutPrefix(code, "!")
+	geoip := geodata.FindGeoIP(list, code)
+	if geoip == nil {
+		return false, e.New("cannot find geoip:" + code + " from " + file).WithPrefix(tagSimulate)
+	}
+	return geoip.Contains(ip) != reverse, nil
+}
@@ -0,0 +1,109 @@
+package routes_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/geodata"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path"
+	"testing"
+)
+
+func simulate(t *testing.T, coreType string, rules string, target *routes.Target) *routes.Decision {
+	var rulesArr serial.OrderedArray
+	if err := json.Unmarshal([]byte(rules), &rulesArr); err != nil {
+		t.Fatal(err)
+	}
+	decision, err := routes.Simulate(coreType, rulesArr, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decision
+}
+
+func TestSimulate(t *testing.T) {
+	builds.Config.XrayHelper.DataDir = t.TempDir()
+	geoip := []*geodata.GeoIP{{CountryCode: "CN", Cidr: []netip.Prefix{netip.MustParsePrefix("1.0.1.0/24")}}}
+	geosite := []*geodata.GeoSite{{CountryCode: "GOOGLE", Domain: []geodata.Domain{{Type: geodata.RootDomain, Value: "google.com"}}}}
+	_ = os.WriteFile(path.Join(builds.Config.XrayHelper.DataDir, "geoip.dat"), geodata.MarshalGeoIP(geoip), 0644)
+	_ = os.WriteFile(path.Join(builds.Config.XrayHelper.DataDir, "geosite.dat"), geodata.MarshalGeoSite(geosite), 0644)
+
+	xrayRules := `[
+		{"type":"field","protocol":["bittorrent"],"outboundTag":"direct"},
+		{"type":"field","inboundTag":["dns-in"],"outboundTag":"dns-out"},
+		{"type":"field","domain":["geosite:google"],"port":"443,8000-9000","outboundTag":"proxy"},
+		{"type":"field","domain":["regexp:^ad\\.","keyword:track"],"outboundTag":"block"},
+		{"type":"field","ip":["geoip:cn","10.0.0.0/8"],"outboundTag":"direct"},
+		{"type":"field","network":"udp","outboundTag":"block"}
+	]`
+	for _, c := range []struct {
+		target   routes.Target
+		index    int
+		outbound string
+	}{
+		{routes.Target{Domain: "www.google.com", Port: 8080, Network: "tcp"}, 2, "proxy"},
+		{routes.Target{Domain: "www.google.com", Port: 80, Network: "tcp"}, -1, ""},
+		{routes.Target{Domain: "ad.example.com", Network: "tcp"}, 3, "block"},
+		{routes.Target{Domain: "cdn.tracker.net", Network: "tcp"}, 3, "block"},
+		{routes.Target{IP: netip.MustParseAddr("1.0.1.9"), Network: "tcp"}, 4, "direct"},
+		{routes.Target{Domain: "example.com", IP: netip.MustParseAddr("10.1.1.1"), Network: "tcp"}, 4, "direct"},
+		{routes.Target{Domain: "example.com", Network: "udp", Inbound: "dns-in"}, 1, "dns-out"},
+		{routes.Target{Domain: "example.com", Network: "udp"}, 5, "block"},
+	} {
+		decision := simulate(t, "xray", xrayRules, &c.target)
+		if decision.Index != c.index || decision.Outbound != c.outbound {
+			t.Errorf("xray %+v: expect [%d] %s, got [%d] %s", c.target, c.index, c.outbound, decision.Index, decision.Outbound)
+		}
+		if _, ok := decision.Skipped[0]; !ok {
+			t.Errorf("xray rule with protocol should be skipped")
+		}
+	}
+
+	singboxRules := `[
+		{"action":"sniff"},
+		{"port":53,"action":"hijack-dns"},
+		{"domain_suffix":[".google.com"],"ip_cidr":["8.8.8.0/24"],"outbound":"proxy"},
+		{"geoip":["cn"],"invert":true,"network":"tcp","outbound":"proxy"},
+		{"port":[443],"port_range":["1000:2000"],"network":"tcp","outbound":"block"},
+		{"rule_set":["geosite-cn"],"outbound":"direct"}
+	]`
+	for _, c := range []struct {
+		target   routes.Target
+		index    int
+		outbound string
+	}{
+		{routes.Target{Domain: "www.google.com", Port: 443, Network: "tcp"}, 2, "proxy"},
+		{routes.Target{IP: netip.MustParseAddr("8.8.8.8"), Port: 53, Network: "udp"}, 1, "action:hijack-dns"},
+		{routes.Target{IP: netip.MustParseAddr("8.8.8.8"), Port: 443, Network: "udp"}, 2, "proxy"},
+		{routes.Target{IP: netip.MustParseAddr("9.9.9.9"), Port: 443, Network: "tcp"}, 3, "proxy"},
+		{routes.Target{IP: netip.MustParseAddr("1.0.1.1"), Port: 1500, Network: "tcp"}, 4, "block"},
+		{routes.Target{IP: netip.MustParseAddr("1.0.1.1"), Port: 443, Network: "tcp"}, 4, "block"},
+		{routes.Target{IP: netip.MustParseAddr("1.0.1.1"), Port: 80, Network: "tcp"}, -1, ""},
+	} {
+		decision := simulate(t, "sing-box", singboxRules, &c.target)
+		if decision.Index != c.index || decision.Outbound != c.outbound {
+			t.Errorf("sing-box %+v: expect [%d] %s, got [%d] %s", c.target, c.index, c.outbound, decision.Index, decision.Outbound)
+		}
+	}
+}
+
+func TestSimulateRouteMalformed(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.json": `{"outbounds":[{"type":"direct","tag":"direct"}],"route":"broken"}`,
+	})
+	builds.Config.XrayHelper.CoreType = "sing-box"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	routes.ClearRule()
+	t.Cleanup(routes.ClearRule)
+	decision, err := routes.SimulateRoute(&routes.Target{Domain: "example.com", Network: "tcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Index != -1 || decision.Outbound != "direct" {
+		t.Errorf("expect the first outbound, got [%d] %s", decision.Index, decision.Outbound)
+	}
+}
@@ -0,0 +1,450 @@
+package routes
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const tagValidate = "validate"
+
+// field kinds of rule
+const (
+	fieldString  = iota
+	fieldList    // string or string array
+	fieldPort    // number or string, like 443 or "80,1000-2000"
+	fieldInt     // number
+	fieldIntList // number or number array
+	fieldBool
+	fieldObject
+	fieldRules // array of nested rules, for sing-box logical rule
+	fieldAny
+)
+
+var fieldKindNames = map[int]string{
+	fieldString:  "string",
+	fieldList:    "string or string array",
+	fieldPort:    "number or string",
+	fieldInt:     "number",
+	fieldIntList: "number or number array",
+	fieldBool:    "bool",
+	fieldObject:  "object",
+	fieldRules:   "rule array",
+}
+
+var xrayRuleFields = map[string]int{
+	"type": fieldString, "domainMatcher": fieldString, "domain": fieldList, "domains": fieldList, "ip": fieldList,
+	"port": fieldPort, "sourcePort": fieldPort, "localPort": fieldPort, "vlessRoute": fieldPort, "network": fieldList,
+	"source": fieldList, "sourceIP": fieldList, "localIP": fieldList, "user": fieldList, "inboundTag": fieldList,
+	"protocol": fieldList, "process": fieldList, "attrs": fieldAny, "webhook": fieldObject,
+	"outboundTag": fieldString, "balancerTag": fieldString, "ruleTag": fieldString,
+}
+
+var singboxRuleFields = map[string]int{
+	"inbound": fieldList, "ip_version": fieldInt, "network": fieldList, "auth_user": fieldList, "protocol": fieldList,
+	"client": fieldList, "domain": fieldList, "domain_suffix": fieldList, "domain_keyword": fieldList, "domain_regex": fieldList,
+	"geosite": fieldList, "source_geoip": fieldList, "geoip": fieldList, "source_ip_cidr": fieldList, "source_ip_is_private": fieldBool,
+	"ip_cidr": fieldList, "ip_is_private": fieldBool, "source_port": fieldIntList, "source_port_range": fieldList,
+	"port": fieldIntList, "port_range": fieldList, "process_name": fieldList, "process_path": fieldList, "process_path_regex": fieldList,
+	"package_name": fieldList, "user": fieldList, "user_id": fieldIntList, "clash_mode": fieldString, "network_type": fieldList,
+	"network_is_expensive": fieldBool, "network_is_constrained": fieldBool, "wifi_ssid": fieldList, "wifi_bssid": fieldList,
+	"interface_address": fieldAny, "network_interface_address": fieldAny, "default_interface_address": fieldList,
+	"rule_set": fieldList, "rule_set_ip_cidr_match_source": fieldBool, "rule_set_ipcidr_match_source": fieldBool, "invert": fieldBool,
+	"type": fieldString, "mode": fieldString, "rules": fieldRules, "action": fieldString, "outbound": fieldString,
+	"override_address": fieldString, "override_port": fieldInt, "network_strategy": fieldString, "fallback_network_type": fieldList,
+	"fallback_delay": fieldString, "udp_disable_domain_unmapping": fieldBool, "udp_connect": fieldBool, "udp_timeout": fieldString,
+	"tls_fragment": fieldBool, "tls_fragment_fallback_delay": fieldString, "tls_record_fragment": fieldBool,
+	"method": fieldString, "no_drop": fieldBool, "sniffer": fieldList, "timeout": fieldString, "strategy": fieldString,
+	"server": fieldString,
+}
+
+// singboxDnsruleFields the extra fields of sing-box dns rule, outbound is a match condition in dns rule
+var singboxDnsruleFields = map[string]int{
+	"query_type": fieldAny, "outbound": fieldList, "disable_cache": fieldBool, "rewrite_ttl": fieldInt, "client_subnet": fieldString,
+	"ip_accept_any": fieldBool, "rule_set_ip_cidr_accept_empty": fieldBool, "rcode": fieldString, "answer": fieldAny, "ns": fieldAny, "extra": fieldAny,
+}
+
+var mihomoRuleTypes = map[string]bool{
+	"DOMAIN": true, "DOMAIN-SUFFIX": true, "DOMAIN-KEYWORD": true, "DOMAIN-REGEX": true, "DOMAIN-WILDCARD": true, "GEOSITE": true,
+	"GEOIP": true, "SRC-GEOIP": true, "IP-ASN": true, "SRC-IP-ASN": true, "IP-CIDR": true, "IP-CIDR6": true, "SRC-IP-CIDR": true,
+	"IP-SUFFIX": true, "SRC-IP-SUFFIX": true, "DST-PORT": true, "SRC-PORT": true, "IN-PORT": true, "IN-TYPE": true, "IN-USER": true,
+	"IN-NAME": true, "PROCESS-NAME": true, "PROCESS-PATH": true, "PROCESS-NAME-REGEX": true, "PROCESS-PATH-REGEX": true,
+	"PROCESS-NAME-WILDCARD": true, "PROCESS-PATH-WILDCARD": true, "UID": true, "NETWORK": true, "DSCP": true, "RULE-SET": true,
+	"SUB-RULE": true, "AND": true, "OR": true, "NOT": true, "MATCH": true,
+}
+
+var mihomoBuiltinTargets = map[string]bool{"DIRECT": true, "REJECT": true, "REJECT-DROP": true, "PASS": true, "COMPATIBLE": true}
+
+var hysteria2BuiltinOutbounds = map[string]bool{"direct": true, "reject": true, "default": true}
+
+var hysteria2AclRegex = regexp.MustCompile(`^([\w-]+)\s*\((.+)\)$`)
+
+// RuleRefs the tags which can be referenced by rules
+type RuleRefs struct {
+	Outbounds map[string]bool
+	Balancers map[string]bool
+	Rulesets  map[string]bool
+	Servers   map[string]bool
+}
+
+func newRuleRefs() *RuleRefs {
+	return &RuleRefs{Outbounds: make(map[string]bool), Balancers: make(map[string]bool), Rulesets: make(map[string]bool), Servers: make(map[string]bool)}
+}
+
+// collectTags collect the value of key from every object in array
+func collectTags(array any, key string, tags map[string]bool) {
+	arr, _ := array.(serial.OrderedArray)
+	for _, item := range arr {
+		if itemMap, ok := item.(serial.OrderedMap); ok {
+			if tag, ok := itemMap.Get(key); ok {
+				tags[serial.ToString(tag.Value)] = true
+			}
+		}
+	}
+}
+
+// loadRuleRefs load the referable tags from core config
+func loadRuleRefs() (*RuleRefs, error) {
+	refs := newRuleRefs()
+	switch builds.Config.XrayHelper.CoreType {
+	case "mihomo":
+		for _, key := range []string{"proxies", "proxy-groups"} {
+			if value, err := loadYamlValue("", key); err == nil {
+				collectTags(value, "name", refs.Outbounds)
+			}
+		}
+		if value, err := loadYamlValue("", "rule-providers"); err == nil {
+			if providers, ok := value.(serial.OrderedMap); ok {
+				for _, provider := range providers.Values {
+					refs.Rulesets[provider.Key] = true
+				}
+			}
+		}
+		return refs, nil
+	case "hysteria2":
+		if value, err := loadYamlValue("", "outbounds"); err == nil {
+			collectTags(value, "name", refs.Outbounds)
+		}
+		return refs, nil
+	}
+	// the sections may be split into several files of conf dir, collect from all of them
+	var foundOutbounds bool
+	read := func(c []byte) error {
+		var jsonMap serial.OrderedMap
+		if err := json.Unmarshal(c, &jsonMap); err != nil {
+			return e.New("json unmarshal failed, " + err.Error()).WithPrefix(tagValidate)
+		}
+		if outbounds, ok := jsonMap.Get("outbounds"); ok {
+			foundOutbounds = true
+			collectTags(outbounds.Value, "tag", refs.Outbounds)
+		}
+		if endpoints, ok := jsonMap.Get("endpoints"); ok {
+			collectTags(endpoints.Value, "tag", refs.Outbounds)
+		}
+		for _, section := range []string{"routing", "route", "dns"} {
+			s, ok := jsonMap.Get(section)
+			if !ok {
+				continue
+			}
+			sectionMap, _ := s.Value.(serial.OrderedMap)
+			if balancers, ok := sectionMap.Get("balancers"); ok {
+				collectTags(balancers.Value, "tag", refs.Balancers)
+			}
+			if ruleSet, ok := sectionMap.Get("rule_set"); ok {
+				collectTags(ruleSet.Value, "tag", refs.Rulesets)
+			}
+			if servers, ok := sectionMap.Get("servers"); ok && section == "dns" {
+				collectTags(servers.Value, "tag", refs.Servers)
+			}
+		}
+		return nil
+	}
+	if err := common.ReadCoreConfDir(read); err != nil {
+		return nil, err
+	}
+	if !foundOutbounds {
+		return nil, e.New("cannot find outbounds from your config").WithPrefix(tagValidate)
+	}
+	return refs, nil
+}
+
+// ValidateRules check rules of core type, return the error of the first invalid rule
+func ValidateRules(coreType string, rules serial.OrderedArray, refs *RuleRefs) error {
+	for i, r := range rules {
+		var err error
+		switch coreType {
+		case "xray":
+			err = validateXrayRule(r, refs)
+		case "sing-box":
+			err = validateSingboxRule(r, singboxRuleFields, "outbound", refs.Outbounds, refs, true)
+		case "mihomo":
+			err = validateMihomoRule(r, refs)
+		case "hysteria2":
+			err = validateHysteria2Rule(r, refs)
+		}
+		if err != nil {
+			return e.New("rule "+strconv.Itoa(i)+", ", err).WithPrefix(tagValidate)
+		}
+	}
+	return nil
+}
+
+// ValidateDnsrules check sing-box dns rules, return the error of the first invalid rule
+func ValidateDnsrules(coreType string, rules serial.OrderedArray, refs *RuleRefs) error {
+	if coreType != "sing-box" {
+		return nil
+	}
+	fields := make(map[string]int)
+	for key, kind := range singboxRuleFields {
+		fields[key] = kind
+	}
+	for key, kind := range singboxDnsruleFields {
+		fields[key] = kind
+	}
+	for i, r := range rules {
+		if err := validateSingboxRule(r, fields, "server", refs.Servers, refs, true); err != nil {
+			return e.New("dns rule "+strconv.Itoa(i)+", ", err).WithPrefix(tagValidate)
+		}
+	}
+	return nil
+}
+
+// isRoutedTag the outbound tags generated by xrayhelper when rules applied
+func isRoutedTag(tag string) bool {
+	for _, prefix := range []string{"xrayhelper-", "xrayhelpercustom-"} {
+		if index, found := strings.CutPrefix(tag, prefix); found {
+			if _, err := strconv.Atoi(index); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkFields check the field names and value types of rule
+func checkFields(ruleMap serial.OrderedMap, fields map[string]int) error {
+	for _, val := range ruleMap.Values {
+		kind, ok := fields[val.Key]
+		if !ok {
+			return e.New("has unknown field " + val.Key)
+		}
+		if !matchKind(val.Value, kind) {
+			return e.New("field " + val.Key + " should be " + fieldKindNames[kind])
+		}
+	}
+	return nil
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case json.Number, int, int64, float64:
+		return true
+	}
+	return false
+}
+
+func matchKind(v any, kind int) bool {
+	switch kind {
+	case fieldString:
+		_, ok := v.(string)
+		return ok
+	case fieldList, fieldIntList:
+		item := func(v any) bool {
+			if kind == fieldList {
+				_, ok := v.(string)
+				return ok
+			}
+			return isNumber(v)
+		}
+		if arr, ok := v.(serial.OrderedArray); ok {
+			for _, a := range arr {
+				if !item(a) {
+					return false
+				}
+			}
+			return true
+		}
+		return item(v)
+	case fieldPort:
+		_, ok := v.(string)
+		return ok || isNumber(v)
+	case fieldInt:
+		return isNumber(v)
+	case fieldBool:
+		_, ok := v.(bool)
+		return ok
+	case fieldObject:
+		_, ok := v.(serial.OrderedMap)
+		return ok
+	case fieldRules:
+		_, ok := v.(serial.OrderedArray)
+		return ok
+	}
+	return true
+}
+
+func validateXrayRule(r any, refs *RuleRefs) error {
+	ruleMap, ok := r.(serial.OrderedMap)
+	if !ok {
+		return e.New("should be an object")
+	}
+	if err := checkFields(ruleMap, xrayRuleFields); err != nil {
+		return err
+	}
+	outbound, hasOutbound := ruleMap.Get("outboundTag")
+	balancer, hasBalancer := ruleMap.Get("balancerTag")
+	if !hasOutbound && !hasBalancer {
+		return e.New("neither outboundTag nor balancerTag is specified")
+	}
+	if hasOutbound {
+		if tag := serial.ToString(outbound.Value); !refs.Outbounds[tag] && !isRoutedTag(tag) {
+			return e.New("outboundTag " + tag + " does not exist in outbounds")
+		}
+	}
+	if hasBalancer {
+		if tag := serial.ToString(balancer.Value); !refs.Balancers[tag] {
+			return e.New("balancerTag " + tag + " does not exist in balancers")
+		}
+	}
+	return nil
+}
+
+// validateSingboxRule check sing-box route or dns rule, target is outbound or server which is required by route action,
+// the nested rules of logical rule are headless
+func validateSingboxRule(r any, fields map[string]int, target string, targets map[string]bool, refs *RuleRefs, top bool) error {
+	ruleMap, ok := r.(serial.OrderedMap)
+	if !ok {
+		return e.New("should be an object")
+	}
+	if err := checkFields(ruleMap, fields); err != nil {
+		return err
+	}
+	if ruleSet, ok := ruleMap.Get("rule_set"); ok {
+		tags, _ := ruleSet.Value.(serial.OrderedArray)
+		if tag, ok := ruleSet.Value.(string); ok {
+			tags = serial.OrderedArray{tag}
+		}
+		for _, tag := range tags {
+			if !refs.Rulesets[serial.ToString(tag)] {
+				return e.New("rule_set " + serial.ToString(tag) + " does not exist in route.rule_set")
+			}
+		}
+	}
+	if t, ok := ruleMap.Get("type"); ok && t.Value == "logical" {
+		mode, _ := ruleMap.Get("mode")
+		if mode == nil || (mode.Value != "and" && mode.Value != "or") {
+			return e.New("logical rule should have mode and or or")
+		}
+		nested, _ := ruleMap.Get("rules")
+		if nested == nil || len(nested.Value.(serial.OrderedArray)) == 0 {
+			return e.New("logical rule should have rules")
+		}
+		for i, n := range nested.Value.(serial.OrderedArray) {
+			if err := validateSingboxRule(n, fields, target, targets, refs, false); err != nil {
+				return e.New("logical rules "+strconv.Itoa(i)+", ", err)
+			}
+		}
+	} else if ok && t.Value != "default" {
+		return e.New("unknown type " + serial.ToString(t.Value))
+	}
+	if !top {
+		return nil
+	}
+	action := "route"
+	if a, ok := ruleMap.Get("action"); ok {
+		action = serial.ToString(a.Value)
+	}
+	if action != "route" {
+		return nil
+	}
+	tag, ok := ruleMap.Get(target)
+	if !ok {
+		return e.New(target + " is required by route action")
+	}
+	if !targets[serial.ToString(tag.Value)] && !isRoutedTag(serial.ToString(tag.Value)) {
+		if target == "server" {
+			return e.New("server " + serial.ToString(tag.Value) + " does not exist in dns.servers")
+		}
+		return e.New("outbound " + serial.ToString(tag.Value) + " does not exist in outbounds")
+	}
+	return nil
+}
+
+// validateMihomoRule check rule like TYPE,payload,target[,option], MATCH,target or AND,((...),(...)),target
+func validateMihomoRule(r any, refs *RuleRefs) error {
+	text, ok := r.(string)
+	if !ok {
+		return e.New("should be a string")
+	}
+	ruleType, rest, _ := strings.Cut(text, ",")
+	ruleType = strings.ToUpper(strings.TrimSpace(ruleType))
+	if !mihomoRuleTypes[ruleType] {
+		return e.New("has unknown type " + ruleType)
+	}
+	var target string
+	switch ruleType {
+	case "SUB-RULE":
+		// target of SUB-RULE is the name of sub-rules
+		return nil
+	case "MATCH":
+		target, _, _ = strings.Cut(rest, ",")
+	case "AND", "OR", "NOT":
+		index := strings.LastIndex(rest, "),")
+		if !strings.HasPrefix(rest, "((") || index < 0 {
+			return e.New("logical rule should be like " + ruleType + ",((rule),(rule)),target")
+		}
+		target, _, _ = strings.Cut(rest[index+2:], ",")
+	default:
+		fields := strings.Split(rest, ",")
+		if len(fields) < 2 {
+			return e.New("should be like " + ruleType + ",payload,target")
+		}
+		target = fields[1]
+		if ruleType == "RULE-SET" && !refs.Rulesets[strings.TrimSpace(fields[0])] {
+			return e.New("rule-provider " + fields[0] + " does not exist in rule-providers")
+		}
+	}
+	if target = strings.TrimSpace(target); !refs.Outbounds[target] && !mihomoBuiltinTargets[target] {
+		return e.New("target " + target + " does not exist in proxies or proxy-groups")
+	}
+	return nil
+}
+
+// validateHysteria2Rule check acl rule like outbound(address[, proto/port][, hijack])
+func validateHysteria2Rule(r any, refs *RuleRefs) error {
+	text, ok := r.(string)
+	if !ok {
+		return e.New("should be a string")
+	}
+	matches := hysteria2AclRegex.FindStringSubmatch(strings.TrimSpace(text))
+	if matches == nil {
+		return e.New("should be like outbound(address[, proto/port][, hijack])")
+	}
+	if !refs.Outbounds[matches[1]] && !hysteria2BuiltinOutbounds[matches[1]] {
+		return e.New("outbound " + matches[1] + " does not exist in outbounds")
+	}
+	return nil
+}
+
+// validateRule check the loaded rules by the tags in core config
+func validateRule() error {
+	refs, err := loadRuleRefs()
+	if err != nil {
+		return err
+	}
+	return ValidateRules(builds.Config.XrayHelper.CoreType, rule, refs)
+}
+
+// validateDnsrule check the loaded dns rules by the tags in core config
+func validateDnsrule() error {
+	refs, err := loadRuleRefs()
+	if err != nil {
+		return err
+	}
+	return ValidateDnsrules(builds.Config.XrayHelper.CoreType, dnsrule, refs)
+}
@@ -0,0 +1,90 @@
+package routes_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	refs := &routes.RuleRefs{
+		Outbounds: map[string]bool{"proxy": true, "direct": true, "PROXY": true, "DIRECT": true},
+		Balancers: map[string]bool{"lb": true},
+		Rulesets:  map[string]bool{"geosite-cn": true, "ads": true},
+		Servers:   map[string]bool{"local": true},
+	}
+	tests := []struct {
+		coreType string
+		rules    string
+		want     string
+	}{
+		{"xray", `[{"type":"field","domain":["geosite:cn"],"port":443,"outboundTag":"direct"},{"ip":"1.1.1.1","balancerTag":"lb"},{"network":"udp","outboundTag":"xrayhelper-3"}]`, ""},
+		{"xray", `[{"domain":["a.com"],"outboundTag":"prxy"}]`, "rule 0, outboundTag prxy does not exist"},
+		{"xray", `[{"domian":["a.com"],"outboundTag":"proxy"}]`, "rule 0, has unknown field domian"},
+		{"xray", `[{"domain":"a.com","outboundTag":"proxy"},{"port":true,"outboundTag":"proxy"}]`, "rule 1, field port should be number or string"},
+		{"xray", `[{"domain":["a.com"]}]`, "neither outboundTag nor balancerTag"},
+		{"xray", `[{"domain":["a.com"],"balancerTag":"lb2"}]`, "balancerTag lb2 does not exist"},
+		{"sing-box", `[{"rule_set":"geosite-cn","outbound":"direct"},{"protocol":"dns","action":"hijack-dns"},{"type":"logical","mode":"or","rules":[{"port":[80,443]},{"ip_is_private":true}],"outbound":"proxy"}]`, ""},
+		{"sing-box", `[{"rule_set":["geosite-us"],"outbound":"direct"}]`, "rule_set geosite-us does not exist"},
+		{"sing-box", `[{"domain":"a.com"}]`, "outbound is required by route action"},
+		{"sing-box", `[{"type":"logical","mode":"xor","rules":[],"outbound":"proxy"}]`, "should have mode"},
+		{"sing-box", `[{"type":"logical","mode":"and","rules":[{"port":"443"}],"outbound":"proxy"}]`, "logical rules 0, field port should be number or number array"},
+		{"mihomo", `["RULE-SET,ads,REJECT","AND,((DOMAIN,a.com),(NETWORK,UDP)),PROXY","IP-CIDR,10.0.0.0/8,DIRECT,no-resolve","MATCH,PROXY"]`, ""},
+		{"mihomo", `["DOMAIN,a.com,Proxy"]`, "target Proxy does not exist"},
+		{"mihomo", `["RULE-SET,cn,DIRECT"]`, "rule-provider cn does not exist"},
+		{"mihomo", `["FOO,a,DIRECT"]`, "unknown type FOO"},
+		{"hysteria2", `["direct(geoip:cn)","proxy(suffix:google.com, tcp/443)"]`, ""},
+		{"hysteria2", `["prxy(all)"]`, "outbound prxy does not exist"},
+	}
+	for _, test := range tests {
+		var rules serial.OrderedArray
+		if err := json.Unmarshal([]byte(test.rules), &rules); err != nil {
+			t.Fatal(err)
+		}
+		err := routes.ValidateRules(test.coreType, rules, refs)
+		if len(test.want) == 0 && err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.coreType, test.rules, err)
+		}
+		if len(test.want) > 0 && (err == nil || !strings.Contains(err.Error(), test.want)) {
+			t.Errorf("%s %s: expect error %q, got %v", test.coreType, test.rules, test.want, err)
+		}
+	}
+	var dnsrules serial.OrderedArray
+	_ = json.Unmarshal([]byte(`[{"query_type":["A",28],"outbound":"any","server":"local"},{"domain":"a.com","server":"remote"}]`), &dnsrules)
+	if err := routes.ValidateDnsrules("sing-box", dnsrules, refs); err == nil || !strings.Contains(err.Error(), "dns rule 1, server remote does not exist") {
+		t.Errorf("unexpected dns rule error %v", err)
+	}
+}
+
+func TestValidateSplitConfDir(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"01_outbounds.json": `{"outbounds":[{"type":"direct","tag":"direct"},{"type":"direct","tag":"proxy"}]}`,
+		"02_route.json":     `{"route":{"rule_set":[{"type":"local","tag":"geosite-cn","path":"cn.srs"}],"rules":[{"rule_set":"geosite-cn","outbound":"direct"}]}}`,
+	})
+	builds.Config.XrayHelper.CoreType = "sing-box"
+	builds.Config.XrayHelper.CoreConfig = dir
+	routes.ClearRule()
+	t.Cleanup(routes.ClearRule)
+	var rule serial.OrderedMap
+	rule.Set("domain", "a.com")
+	rule.Set("outbound", "proxy")
+	if !routes.AddRule(&rule) {
+		t.Fatal("add rule failed")
+	}
+	if err := routes.ApplyRule(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := os.ReadFile(path.Join(dir, "02_route.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(result), `"a.com"`) || !strings.Contains(string(result), `"geosite-cn"`) {
+		t.Errorf("expect rules applied:\n%s", result)
+	}
+}
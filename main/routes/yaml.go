@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"gopkg.in/yaml.v3"
+	"path"
+)
+
+const tagYaml = "yaml"
+
+// isYamlCore whether the routing of current core is in yaml config, mihomo or hysteria2
+func isYamlCore() bool {
+	switch builds.Config.XrayHelper.CoreType {
+	case "mihomo", "hysteria2":
+		return true
+	}
+	return false
+}
+
+// yamlConfs the yaml configs which contain routing, the clash template goes first since it overrides config.yaml when core starts
+func yamlConfs() []string {
+	switch builds.Config.XrayHelper.CoreType {
+	case "mihomo":
+		var confs []string
+		if len(builds.Config.Clash.Template) > 0 {
+			confs = append(confs, builds.Config.Clash.Template)
+		}
+		return append(confs, path.Join(builds.Config.XrayHelper.CoreConfig, "config.yaml"))
+	case "hysteria2":
+		return []string{builds.Config.XrayHelper.CoreConfig}
+	}
+	return nil
+}
+
+func readYaml(conf string) (*serial.OrderedMap, error) {
+	confByte, err := common.ReadConfFile(conf)
+	if err != nil {
+		return nil, e.New("read yaml config failed, ", err).WithPrefix(tagYaml)
+	}
+	var yamlMap serial.OrderedMap
+	if err := yaml.Unmarshal(confByte, &yamlMap); err != nil {
+		return nil, e.New("yaml unmarshal "+conf+" failed, ", err).WithPrefix(tagYaml)
+	}
+	return &yamlMap, nil
+}
+
+// loadYamlValue get the value of key in the first yaml config which contains key, parent is the optional outer map key like acl
+func loadYamlValue(parent string, key string) (any, error) {
+	for _, conf := range yamlConfs() {
+		yamlMap, err := readYaml(conf)
+		if err != nil {
+			return nil, err
+		}
+		if len(parent) > 0 {
+			p, ok := yamlMap.Get(parent)
+			if !ok {
+				continue
+			}
+			parentMap, ok := p.Value.(serial.OrderedMap)
+			if !ok {
+				return nil, e.New(parent + " in " + conf + " is not a map").WithPrefix(tagYaml)
+			}
+			yamlMap = &parentMap
+		}
+		if value, ok := yamlMap.Get(key); ok {
+			return value.Value, nil
+		}
+	}
+	return nil, e.New("cannot find " + key + " from your config").WithPrefix(tagYaml)
+}
+
+// applyYamlValue set key in yaml configs, the clash template is only changed when it contains the top key already
+func applyYamlValue(parent string, key string, value any) error {
+	confs := yamlConfs()
+	for i, conf := range confs {
+		top := key
+		if len(parent) > 0 {
+			top = parent
+		}
+		yamlMap, err := readYaml(conf)
+		if err != nil {
+			return err
+		}
+		if _, ok := yamlMap.Get(top); !ok && i < len(confs)-1 {
+			continue
+		}
+		if len(parent) > 0 {
+			var parentMap serial.OrderedMap
+			if p, ok := yamlMap.Get(parent); ok {
+				if parentMap, ok = p.Value.(serial.OrderedMap); !ok {
+					return e.New(parent + " in " + conf + " is not a map").WithPrefix(tagYaml)
+				}
+			}
+			parentMap.Set(key, value)
+			yamlMap.Set(parent, parentMap)
+		} else {
+			yamlMap.Set(key, value)
+		}
+		marshal, err := yaml.Marshal(yamlMap)
+		if err != nil {
+			return e.New("marshal yaml config failed, ", err).WithPrefix(tagYaml)
+		}
+		if err := common.WriteConfFile(conf, marshal); err != nil {
+			return e.New("write yaml config failed, ", err).WithPrefix(tagYaml)
+		}
+	}
+	return nil
+}
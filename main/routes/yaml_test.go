@@ -0,0 +1,54 @@
+package routes_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/routes"
+	"XrayHelper/main/serial"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestYamlRule(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.yaml": "rule-providers:\n  ads:\n    type: http\n    url: https://example.com/ads.yaml\nproxy-groups:\n  - name: PROXY\n    type: select\nrules:\n  - MATCH,DIRECT\n",
+	})
+	builds.Config.XrayHelper.CoreType = "mihomo"
+	builds.Config.XrayHelper.CoreConfig = dir
+	builds.Config.Clash.Template = ""
+	rule := "DOMAIN-SUFFIX,google.com,PROXY"
+	if !routes.AddRule(&rule) {
+		t.Fatal("edit rule failed")
+	}
+	if err := routes.ApplyRule(); err != nil {
+		t.Fatal(err)
+	}
+	rulesets := routes.GetRuleset()
+	if len(rulesets) != 1 {
+		t.Fatalf("expect 1 rule-provider, got %v", rulesets)
+	}
+	var provider serial.OrderedMap
+	provider.Set("name", "cn")
+	provider.Set("type", "file")
+	routes.AddRuleset(&provider)
+	if err := routes.ApplyRuleset(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := os.ReadFile(path.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Index(string(result), "DOMAIN-SUFFIX,google.com,PROXY") > strings.Index(string(result), "MATCH,DIRECT") {
+		t.Errorf("expect added rule before MATCH:\n%s", result)
+	}
+	for _, want := range []string{"ads:\n        type: http", "cn:\n        type: file"} {
+		if !strings.Contains(string(result), want) {
+			t.Errorf("expect %q in config:\n%s", want, result)
+		}
+	}
+	if strings.Contains(string(result), "name: cn") {
+		t.Errorf("name should be the key of rule-provider:\n%s", result)
+	}
+}
@@ -1,5 +1,13 @@
 package addon
 
+import (
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
 type Addon struct {
 	//addon
 	//ws/httpupgrade/spilthttp/h2->host quic->security grpc->authority
@@ -20,9 +28,49 @@ type Addon struct {
 }
 
 type NodeInfo struct {
+	Id       string `json:"id"`
 	Remarks  string `json:"remarks"`
 	Type     string `json:"type"`
 	Host     string `json:"host"`
 	Port     string `json:"port"`
 	Protocol string `json:"protocol"`
+	Security string `json:"security,omitempty"`
+	Sni      string `json:"sni,omitempty"`
+	ExitIp   string `json:"exitIp,omitempty"`
+	Country  string `json:"country,omitempty"`
+}
+
+// NodeId get a stable node id, the hash of protocol, server, port and credentials, keep same after subscribe refresh
+func NodeId(protocol string, server string, port string, credentials ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(append([]string{protocol, server, port}, credentials...), "\x00")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// SetDialerProxy make the outbound dial through the outbound of dialer tag, proxy chain
+func SetDialerProxy(outbound *serial.OrderedMap, coreType string, dialer string) error {
+	switch coreType {
+	case "xray":
+		var streamSettingsObject, sockoptObject serial.OrderedMap
+		if streamSettings, ok := outbound.Get("streamSettings"); ok {
+			streamSettingsObject, _ = streamSettings.Value.(serial.OrderedMap)
+		}
+		if sockopt, ok := streamSettingsObject.Get("sockopt"); ok {
+			sockoptObject, _ = sockopt.Value.(serial.OrderedMap)
+		}
+		sockoptObject.Set("dialerProxy", dialer)
+		streamSettingsObject.Set("sockopt", sockoptObject)
+		outbound.Set("streamSettings", streamSettingsObject)
+	case "v2ray":
+		var proxySettingsObject serial.OrderedMap
+		proxySettingsObject.Set("tag", dialer)
+		proxySettingsObject.Set("transportLayer", true)
+		outbound.Set("proxySettings", proxySettingsObject)
+	case "sing-box":
+		outbound.Set("detour", dialer)
+	case "mihomo":
+		outbound.Set("dialer-proxy", dialer)
+	default:
+		return e.New(coreType + " not support proxy chain").WithPrefix(tagAddon)
+	}
+	return nil
 }
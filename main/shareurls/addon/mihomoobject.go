@@ -0,0 +1,100 @@
+package addon
+
+import (
+	"XrayHelper/main/builds"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"strings"
+)
+
+const tagAddon = "addon"
+
+// SetTransportObjectMihomo set transport options into mihomo proxy Object
+func SetTransportObjectMihomo(addon *Addon, network string, proxyObject *serial.OrderedMap) error {
+	switch network {
+	case "", "tcp", "raw":
+		if addon.Type == "http" {
+			proxyObject.Set("network", "http")
+			var httpOptsObject serial.OrderedMap
+			if len(addon.Host) > 0 {
+				var headersObject serial.OrderedMap
+				var host serial.OrderedArray
+				host = append(host, addon.Host)
+				headersObject.Set("Host", host)
+				httpOptsObject.Set("headers", headersObject)
+			}
+			if len(addon.Path) > 0 {
+				var path serial.OrderedArray
+				path = append(path, addon.Path)
+				httpOptsObject.Set("path", path)
+			}
+			proxyObject.Set("http-opts", httpOptsObject)
+		} else {
+			proxyObject.Set("network", "tcp")
+		}
+	case "ws", "httpupgrade":
+		proxyObject.Set("network", "ws")
+		var wsOptsObject serial.OrderedMap
+		if len(addon.Path) > 0 {
+			wsOptsObject.Set("path", addon.Path)
+		}
+		if len(addon.Host) > 0 {
+			var headersObject serial.OrderedMap
+			headersObject.Set("Host", addon.Host)
+			wsOptsObject.Set("headers", headersObject)
+		}
+		if network == "httpupgrade" {
+			wsOptsObject.Set("v2ray-http-upgrade", true)
+		}
+		proxyObject.Set("ws-opts", wsOptsObject)
+	case "http", "h2":
+		proxyObject.Set("network", "h2")
+		var h2OptsObject serial.OrderedMap
+		if len(addon.Host) > 0 {
+			var host serial.OrderedArray
+			host = append(host, addon.Host)
+			h2OptsObject.Set("host", host)
+		}
+		if len(addon.Path) > 0 {
+			h2OptsObject.Set("path", addon.Path)
+		}
+		proxyObject.Set("h2-opts", h2OptsObject)
+	case "grpc":
+		proxyObject.Set("network", "grpc")
+		var grpcOptsObject serial.OrderedMap
+		grpcOptsObject.Set("grpc-service-name", addon.Path)
+		proxyObject.Set("grpc-opts", grpcOptsObject)
+	default:
+		return e.New("mihomo not support network " + network).WithPrefix(tagAddon)
+	}
+	return nil
+}
+
+// SetTlsObjectMihomo set tls options into mihomo proxy Object, trojan use sni as server name key
+func SetTlsObjectMihomo(addon *Addon, security string, sniKey string, proxyObject *serial.OrderedMap) {
+	if len(security) == 0 || security == "none" {
+		proxyObject.Set("tls", false)
+		return
+	}
+	proxyObject.Set("tls", true)
+	if len(addon.Sni) > 0 {
+		proxyObject.Set(sniKey, addon.Sni)
+	}
+	var alpn serial.OrderedArray
+	for _, v := range strings.Split(addon.Alpn, ",") {
+		if len(v) > 0 {
+			alpn = append(alpn, v)
+			proxyObject.Set("alpn", alpn)
+		}
+	}
+	if len(addon.FingerPrint) > 0 {
+		proxyObject.Set("client-fingerprint", addon.FingerPrint)
+	}
+	if security == "reality" {
+		var realityOptsObject serial.OrderedMap
+		realityOptsObject.Set("public-key", addon.PublicKey)
+		realityOptsObject.Set("short-id", addon.ShortId)
+		proxyObject.Set("reality-opts", realityOptsObject)
+	}
+	proxyObject.Set("skip-cert-verify", builds.Config.XrayHelper.AllowInsecure)
+}
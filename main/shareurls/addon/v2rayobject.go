@@ -0,0 +1,83 @@
+package addon
+
+import (
+	"XrayHelper/main/builds"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/serial"
+	"strings"
+)
+
+// GetStreamSettingsObjectV2ray get addon StreamSettingsObject v2ray jsonv5
+func GetStreamSettingsObjectV2ray(addon *Addon, network string, security string) (serial.OrderedMap, error) {
+	var streamSettingsObject serial.OrderedMap
+	var transportSettingsObject serial.OrderedMap
+	switch network {
+	case "", "tcp", "raw":
+		streamSettingsObject.Set("transport", "tcp")
+	case "kcp":
+		streamSettingsObject.Set("transport", "kcp")
+		if len(addon.Path) > 0 {
+			transportSettingsObject.Set("seed", addon.Path)
+		}
+	case "ws":
+		streamSettingsObject.Set("transport", "ws")
+		if len(addon.Path) > 0 {
+			transportSettingsObject.Set("path", addon.Path)
+		}
+		if len(addon.Host) > 0 {
+			var headerArray serial.OrderedArray
+			var hostObject serial.OrderedMap
+			hostObject.Set("key", "Host")
+			hostObject.Set("value", addon.Host)
+			headerArray = append(headerArray, hostObject)
+			transportSettingsObject.Set("header", headerArray)
+		}
+	case "http", "h2":
+		streamSettingsObject.Set("transport", "h2")
+		if len(addon.Host) > 0 {
+			var host serial.OrderedArray
+			host = append(host, addon.Host)
+			transportSettingsObject.Set("host", host)
+		}
+		if len(addon.Path) > 0 {
+			transportSettingsObject.Set("path", addon.Path)
+		}
+	case "httpupgrade":
+		streamSettingsObject.Set("transport", "httpupgrade")
+		if len(addon.Host) > 0 {
+			transportSettingsObject.Set("host", addon.Host)
+		}
+		if len(addon.Path) > 0 {
+			transportSettingsObject.Set("path", addon.Path)
+		}
+	case "grpc":
+		streamSettingsObject.Set("transport", "grpc")
+		if len(addon.Path) > 0 {
+			transportSettingsObject.Set("serviceName", addon.Path)
+		}
+	default:
+		return streamSettingsObject, e.New("v2ray not support network " + network).WithPrefix(tagAddon)
+	}
+	streamSettingsObject.Set("transportSettings", transportSettingsObject)
+	switch security {
+	case "", "none":
+	case "tls":
+		streamSettingsObject.Set("security", "tls")
+		var securitySettingsObject serial.OrderedMap
+		if len(addon.Sni) > 0 {
+			securitySettingsObject.Set("serverName", addon.Sni)
+		}
+		var alpn serial.OrderedArray
+		for _, v := range strings.Split(addon.Alpn, ",") {
+			if len(v) > 0 {
+				alpn = append(alpn, v)
+				securitySettingsObject.Set("nextProtocol", alpn)
+			}
+		}
+		securitySettingsObject.Set("allowInsecure", builds.Config.XrayHelper.AllowInsecure)
+		streamSettingsObject.Set("securitySettings", securitySettingsObject)
+	default:
+		return streamSettingsObject, e.New("v2ray not support security " + security).WithPrefix(tagAddon)
+	}
+	return streamSettingsObject, nil
+}
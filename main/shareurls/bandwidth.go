@@ -0,0 +1,94 @@
+package shareurls
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/log"
+	"context"
+	"golang.org/x/net/proxy"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Bandwidth test the download throughput of results through the test service
+func Bandwidth(coreType string, results []*Result) {
+	service, err := runTestService(coreType, results)
+	if err != nil {
+		log.HandleDebug(err)
+		return
+	}
+	defer stopTestService(service)
+	parallel := builds.Config.Speedtest.DownloadParallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	// limit the parallelism, so that nodes don't compete for bandwidth
+	semaphore := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, result := range service.results {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(result *Result) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:"+strconv.Itoa(result.Port), nil, proxy.Direct)
+			if err != nil {
+				log.HandleDebug("set socks5 proxy: " + err.Error())
+				return
+			}
+			result.Mbps = Download(dialer)
+		}(result)
+	}
+	wg.Wait()
+}
+
+// Download download from the test url through dialer for a bounded time and size, return the throughput (Mbps), -1 if failed
+func Download(dialer proxy.Dialer) float64 {
+	duration := time.Duration(builds.Config.Speedtest.DownloadTime) * time.Millisecond
+	limit := int64(builds.Config.Speedtest.DownloadSize) << 20
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.Dial(network, addr)
+		},
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: 3 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "GET", builds.Config.Speedtest.DownloadUrl, nil)
+	if err != nil {
+		log.HandleDebug("create download request: " + err.Error())
+		return -1
+	}
+	response, err := (&http.Client{Transport: transport}).Do(request)
+	if err != nil {
+		log.HandleDebug("download " + builds.Config.Speedtest.DownloadUrl + ": " + err.Error())
+		return -1
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	if response.StatusCode != http.StatusOK {
+		log.HandleDebug("download " + builds.Config.Speedtest.DownloadUrl + " get " + strconv.Itoa(response.StatusCode))
+		return -1
+	}
+	// start timing after response header, the deadline of context stop the download
+	start := time.Now()
+	var reader io.Reader = response.Body
+	if limit > 0 {
+		reader = io.LimitReader(response.Body, limit)
+	}
+	size, _ := io.Copy(io.Discard, reader)
+	elapsed := time.Since(start).Seconds()
+	if size == 0 || elapsed <= 0 {
+		return -1
+	}
+	return float64(size) * 8 / elapsed / 1e6
+}
@@ -0,0 +1,32 @@
+package shareurls_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/log"
+	"XrayHelper/main/shareurls"
+	"bytes"
+	"golang.org/x/net/proxy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	verbose := false
+	log.Verbose = &verbose
+	data := bytes.Repeat([]byte{0}, 4<<20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+	builds.Config.Speedtest.DownloadUrl = server.URL
+	builds.Config.Speedtest.DownloadTime = 5000
+	builds.Config.Speedtest.DownloadSize = 1
+	if mbps := shareurls.Download(proxy.Direct); mbps <= 0 {
+		t.Errorf("expect positive throughput, got %f", mbps)
+	}
+	builds.Config.Speedtest.DownloadUrl = server.URL + "/%zz"
+	if mbps := shareurls.Download(proxy.Direct); mbps != -1 {
+		t.Errorf("expect -1 for bad url, got %f", mbps)
+	}
+}
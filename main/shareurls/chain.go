@@ -0,0 +1,59 @@
+package shareurls
+
+import (
+	"XrayHelper/main/serial"
+	"XrayHelper/main/shareurls/addon"
+	"github.com/fatih/color"
+)
+
+// Chain the node which dials through the relay node, the relay outbound is tagged by RelayTag
+type Chain struct {
+	Node  ShareUrl
+	Relay ShareUrl
+}
+
+// RelayTag get the outbound tag of the relay node of chain
+func RelayTag(tag string) string {
+	return tag + "-relay"
+}
+
+func (this *Chain) GetNodeInfo() *addon.NodeInfo {
+	nodeInfo := this.Node.GetNodeInfo()
+	relayInfo := this.Relay.GetNodeInfo()
+	nodeInfo.Id = addon.NodeId("Chain", nodeInfo.Id, relayInfo.Id)
+	nodeInfo.Remarks += " via " + relayInfo.Remarks
+	return nodeInfo
+}
+
+func (this *Chain) GetNodeInfoStr() string {
+	return this.Node.GetNodeInfoStr() + color.BlueString(", Via: ") + this.Relay.GetNodeInfo().Remarks
+}
+
+// ToOutboundWithTag get the outbound of node, which dials through the relay outbound tagged by RelayTag
+func (this *Chain) ToOutboundWithTag(coreType string, tag string) (*serial.OrderedMap, error) {
+	outbound, err := this.Node.ToOutboundWithTag(coreType, tag)
+	if err != nil {
+		return nil, err
+	}
+	if err := addon.SetDialerProxy(outbound, coreType, RelayTag(tag)); err != nil {
+		return nil, err
+	}
+	return outbound, nil
+}
+
+// ToOutbounds get the outbounds of node, the relay outbound follows if node is a chain
+func ToOutbounds(url ShareUrl, coreType string, tag string) ([]*serial.OrderedMap, error) {
+	outbound, err := url.ToOutboundWithTag(coreType, tag)
+	if err != nil {
+		return nil, err
+	}
+	outbounds := []*serial.OrderedMap{outbound}
+	if chain, ok := url.(*Chain); ok {
+		relay, err := chain.Relay.ToOutboundWithTag(coreType, RelayTag(tag))
+		if err != nil {
+			return nil, err
+		}
+		outbounds = append(outbounds, relay)
+	}
+	return outbounds, nil
+}
@@ -0,0 +1,57 @@
+package shareurls_test
+
+import (
+	"XrayHelper/main/serial"
+	"XrayHelper/main/shareurls"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	node, _ := shareurls.Parse("trojan://pass@1.com:443?security=tls#A")
+	relay, _ := shareurls.Parse("trojan://pass@2.com:443?security=tls#B")
+	chain := &shareurls.Chain{Node: node, Relay: relay}
+	if remarks := chain.GetNodeInfo().Remarks; remarks != "A via B" {
+		t.Errorf("expect remarks A via B, got %s", remarks)
+	}
+	dialer := func(outbound *serial.OrderedMap, keys ...string) any {
+		m := *outbound
+		for i, key := range keys {
+			value, ok := m.Get(key)
+			if !ok {
+				return nil
+			}
+			if i == len(keys)-1 {
+				return value.Value
+			}
+			m, _ = value.Value.(serial.OrderedMap)
+		}
+		return nil
+	}
+	tests := []struct {
+		coreType string
+		keys     []string
+	}{
+		{"xray", []string{"streamSettings", "sockopt", "dialerProxy"}},
+		{"v2ray", []string{"proxySettings", "tag"}},
+		{"sing-box", []string{"detour"}},
+		{"mihomo", []string{"dialer-proxy"}},
+	}
+	for _, test := range tests {
+		outbounds, err := shareurls.ToOutbounds(chain, test.coreType, "proxy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outbounds) != 2 {
+			t.Fatalf("%s: expect node and relay outbounds, got %d", test.coreType, len(outbounds))
+		}
+		if got := dialer(outbounds[0], test.keys...); got != "proxy-relay" {
+			t.Errorf("%s: expect dial through proxy-relay, got %v", test.coreType, got)
+		}
+		if got := dialer(outbounds[1], test.keys...); got != nil {
+			t.Errorf("%s: relay should dial directly, got %v", test.coreType, got)
+		}
+	}
+	if _, err := chain.ToOutboundWithTag("hysteria2", ""); err == nil {
+		t.Error("expect hysteria2 not support proxy chain")
+	}
+}
@@ -0,0 +1,62 @@
+package shareurls
+
+import (
+	"XrayHelper/main/builds"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/geodata"
+	"XrayHelper/main/log"
+	"context"
+	"golang.org/x/net/proxy"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+	"time"
+)
+
+// ExitIp request the ipUrl through dialer, return the exit ip
+func ExitIp(dialer proxy.Dialer) (string, error) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.Dial(network, addr)
+		},
+		TLSHandshakeTimeout: 3 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: time.Duration(builds.Config.Speedtest.Timeout) * time.Millisecond}
+	response, err := client.Get(builds.Config.Speedtest.IpUrl)
+	if err != nil {
+		return "", e.New("request "+builds.Config.Speedtest.IpUrl+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	body, err := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if err != nil {
+		return "", e.New("read "+builds.Config.Speedtest.IpUrl+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	// support plain text ip, or key-value lines like cloudflare cdn-cgi/trace
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "ip="))
+		if ip, err := netip.ParseAddr(line); err == nil {
+			return ip.Unmap().String(), nil
+		}
+	}
+	return "", e.New("cannot find ip from the response of " + builds.Config.Speedtest.IpUrl).WithPrefix(tagSpeedtest)
+}
+
+// locate set the exit country of results by geoip.dat in DataDir
+func locate(results []*Result) {
+	list, err := geodata.LoadGeoIP(path.Join(builds.Config.XrayHelper.DataDir, "geoip.dat"))
+	if err != nil {
+		log.HandleDebug(err)
+		return
+	}
+	for _, result := range results {
+		if ip, err := netip.ParseAddr(result.ExitIp); err == nil {
+			result.Country = geodata.Country(list, ip)
+		}
+	}
+}
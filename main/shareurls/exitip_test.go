@@ -0,0 +1,32 @@
+package shareurls_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/shareurls"
+	"golang.org/x/net/proxy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExitIp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plain":
+			_, _ = w.Write([]byte("203.0.113.7\n"))
+		case "/trace":
+			_, _ = w.Write([]byte("fl=123\nh=example.com\nip=2001:db8::1\nts=1.0\n"))
+		default:
+			_, _ = w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer server.Close()
+	builds.Config.Speedtest.Timeout = 2000
+	for path, expect := range map[string]string{"/plain": "203.0.113.7", "/trace": "2001:db8::1", "/html": ""} {
+		builds.Config.Speedtest.IpUrl = server.URL + path
+		ip, err := shareurls.ExitIp(proxy.Direct)
+		if ip != expect || (len(expect) == 0) != (err != nil) {
+			t.Errorf("%s: expect %q, got %q, %v", path, expect, ip, err)
+		}
+	}
+}
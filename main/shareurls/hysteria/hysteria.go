@@ -1,12 +1,14 @@
 package hysteria
 
 import (
+	"XrayHelper/main/builds"
 	e "XrayHelper/main/errors"
 	"XrayHelper/main/serial"
 	"XrayHelper/main/shareurls/addon"
 	"fmt"
 	"github.com/fatih/color"
 	"strconv"
+	"strings"
 )
 
 const tagHysteria = "hysteria"
@@ -28,6 +30,7 @@ type Hysteria struct {
 
 func (this *Hysteria) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("Hysteria", this.Host, this.Port, this.Auth),
 		Remarks:  this.Remarks,
 		Type:     "Hysteria",
 		Host:     this.Host,
@@ -57,6 +60,33 @@ func (this *Hysteria) ToOutboundWithTag(coreType string, tag string) (*serial.Or
 		outboundObject.Set("auth_str", this.Auth)
 		outboundObject.Set("tls", getHysteriaTlsObjectSingbox(this))
 		return &outboundObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "hysteria")
+		proxyObject.Set("server", this.Host)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		proxyObject.Set("auth-str", this.Auth)
+		proxyObject.Set("up", this.UpMBPS)
+		proxyObject.Set("down", this.DownMBPS)
+		if len(this.ObfsParam) > 0 {
+			proxyObject.Set("obfs", this.ObfsParam)
+		}
+		if len(this.Protocol) > 0 {
+			proxyObject.Set("protocol", this.Protocol)
+		}
+		proxyObject.Set("sni", this.Peer)
+		insecure, _ := strconv.ParseBool(this.Insecure)
+		proxyObject.Set("skip-cert-verify", builds.Config.XrayHelper.AllowInsecure || insecure)
+		var alpn serial.OrderedArray
+		for _, v := range strings.Split(this.Alpn, ",") {
+			if len(v) > 0 {
+				alpn = append(alpn, v)
+				proxyObject.Set("alpn", alpn)
+			}
+		}
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagHysteria).WithPathObj(*this)
 	}
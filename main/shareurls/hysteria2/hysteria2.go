@@ -1,6 +1,7 @@
 package hysteria2
 
 import (
+	"XrayHelper/main/builds"
 	e "XrayHelper/main/errors"
 	"XrayHelper/main/serial"
 	"XrayHelper/main/shareurls/addon"
@@ -25,6 +26,7 @@ type Hysteria2 struct {
 
 func (this *Hysteria2) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("Hysteria2", this.Host, this.Port, this.Auth),
 		Remarks:  this.Remarks,
 		Type:     "Hysteria2",
 		Host:     this.Host,
@@ -64,6 +66,24 @@ func (this *Hysteria2) ToOutboundWithTag(coreType string, tag string) (*serial.O
 		}
 		clientObject.Set("tls", getHysteria2TlsObjectHysteria2(this))
 		return &clientObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "hysteria2")
+		proxyObject.Set("server", this.Host)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		proxyObject.Set("password", this.Auth)
+		if len(this.Obfs) > 0 {
+			proxyObject.Set("obfs", this.Obfs)
+			proxyObject.Set("obfs-password", this.ObfsPassword)
+		}
+		if len(this.Sni) > 0 {
+			proxyObject.Set("sni", this.Sni)
+		}
+		insecure, _ := strconv.ParseBool(this.Insecure)
+		proxyObject.Set("skip-cert-verify", builds.Config.XrayHelper.AllowInsecure || insecure)
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagHysteria2).WithPathObj(*this)
 	}
@@ -23,6 +23,7 @@ type Shadowsocks struct {
 
 func (this *Shadowsocks) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("Shadowsocks", this.Server, this.Port, this.Method, this.Password),
 		Remarks:  this.Remarks,
 		Type:     "Shadowsocks",
 		Host:     this.Server,
@@ -61,6 +62,35 @@ func (this *Shadowsocks) ToOutboundWithTag(coreType string, tag string) (*serial
 			outboundObject.Set("plugin_opts", this.PluginOpt)
 		}
 		return &outboundObject, nil
+	case "v2ray":
+		if len(this.Plugin) > 0 {
+			return nil, e.New("v2ray not support shadowsocks plugin " + this.Plugin).WithPrefix(tagShadowsocks).WithPathObj(*this)
+		}
+		var settingsObject serial.OrderedMap
+		settingsObject.Set("address", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		settingsObject.Set("port", port)
+		settingsObject.Set("method", this.Method)
+		settingsObject.Set("password", this.Password)
+		var outboundObject serial.OrderedMap
+		outboundObject.Set("protocol", "shadowsocks")
+		outboundObject.Set("settings", settingsObject)
+		outboundObject.Set("tag", tag)
+		return &outboundObject, nil
+	case "mihomo":
+		if len(this.Plugin) > 0 {
+			return nil, e.New("mihomo not support shadowsocks plugin " + this.Plugin).WithPrefix(tagShadowsocks).WithPathObj(*this)
+		}
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "ss")
+		proxyObject.Set("server", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		proxyObject.Set("cipher", this.Method)
+		proxyObject.Set("password", this.Password)
+		proxyObject.Set("udp", true)
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagShadowsocks).WithPathObj(*this)
 	}
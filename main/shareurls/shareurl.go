@@ -1,9 +1,13 @@
 package shareurls
 
 import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
 	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
 	"XrayHelper/main/serial"
 	"XrayHelper/main/shareurls/addon"
+	"path"
 	"strings"
 )
 
@@ -55,3 +59,31 @@ func Parse(link string) (ShareUrl, error) {
 	}
 	return nil, e.New("not a supported share link").WithPrefix(tagShareurl)
 }
+
+// LoadNodes load the share links of subscribe nodes (sub.txt) or custom nodes (custom.txt), invalid links are dropped
+func LoadNodes(custom bool) ([]ShareUrl, error) {
+	nodeTxt := path.Join(builds.Config.XrayHelper.DataDir, "sub.txt")
+	if custom {
+		nodeTxt = path.Join(builds.Config.XrayHelper.DataDir, "custom.txt")
+	}
+	content, err := common.ReadConfFile(nodeTxt)
+	if err != nil {
+		return nil, e.New("open proxy node file failed, ", err).WithPrefix(tagShareurl)
+	}
+	var nodes []ShareUrl
+	for _, link := range strings.Split(string(content), "\n") {
+		link = strings.TrimSpace(link)
+		if len(link) > 0 {
+			shareUrl, err := Parse(link)
+			if err != nil {
+				log.HandleDebug("switch: " + err.Error() + ", drop it")
+				continue
+			}
+			nodes = append(nodes, shareUrl)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, e.New("no valid nodes").WithPrefix(tagShareurl)
+	}
+	return nodes, nil
+}
@@ -21,6 +21,7 @@ type Socks struct {
 
 func (this *Socks) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("Socks", this.Server, this.Port, this.User, this.Password),
 		Remarks:  this.Remarks,
 		Type:     "Socks",
 		Host:     this.Server,
@@ -55,6 +56,29 @@ func (this *Socks) ToOutboundWithTag(coreType string, tag string) (*serial.Order
 			outboundObject.Set("password", this.Password)
 		}
 		return &outboundObject, nil
+	case "v2ray":
+		var settingsObject serial.OrderedMap
+		settingsObject.Set("address", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		settingsObject.Set("port", port)
+		var outboundObject serial.OrderedMap
+		outboundObject.Set("protocol", "socks")
+		outboundObject.Set("settings", settingsObject)
+		outboundObject.Set("tag", tag)
+		return &outboundObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "socks5")
+		proxyObject.Set("server", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		if len(this.User) > 0 && this.User != "null" {
+			proxyObject.Set("username", this.User)
+			proxyObject.Set("password", this.Password)
+		}
+		proxyObject.Set("udp", true)
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagSocks).WithPathObj(*this)
 	}
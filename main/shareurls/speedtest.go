@@ -10,9 +10,11 @@ import (
 	"context"
 	"encoding/json"
 	"golang.org/x/net/proxy"
+	"gopkg.in/yaml.v3"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"path"
 	"strconv"
@@ -20,37 +22,38 @@ import (
 	"time"
 )
 
-const (
-	tagSpeedtest = "speedtest"
-	testUrl      = "https://www.google.com/generate_204"
-)
+const tagSpeedtest = "speedtest"
 
+// Result the speedtest result, Value is the realping total time and FirstByte is the first-byte time (ms), Total is the tls time of tcping,
+// Mbps is the download throughput, Udp is the round-trip time (ms) of udp test, -1 means failed, ExitIp and Country are detected by realping if exitIp enabled
 type Result struct {
-	Index string
-	Url   ShareUrl
-	Port  int
-	Value int
+	Index     string
+	Url       ShareUrl
+	Port      int
+	Value     int
+	FirstByte int
+	Total     int
+	Mbps      float64
+	Udp       int
+	ExitIp    string
+	Country   string
+	Reason    string
 }
 
 func RealPing(coreType string, results []*Result) {
-	configPath := path.Join(builds.Config.XrayHelper.RunDir, "test.json")
-	// start test service
-	service, err := startTestService(coreType, configPath, results)
+	service, err := runTestService(coreType, results)
 	if err != nil {
 		log.HandleDebug(err)
-		return
-	}
-	defer stopTestService(service, configPath)
-	// check service port
-	for _, result := range results {
-		if common.CheckLocalPort(strconv.Itoa(service.Pid()), strconv.Itoa(result.Port), 2*time.Second) {
-			continue
+		for _, result := range results {
+			if len(result.Reason) == 0 {
+				result.Reason = err.Error()
+			}
 		}
-		log.HandleDebug("service not listen for RealPing")
 		return
 	}
+	defer stopTestService(service)
 	var wg sync.WaitGroup
-	for _, result := range results {
+	for _, result := range service.results {
 		wg.Add(1)
 		go func(result *Result) {
 			defer wg.Done()
@@ -58,26 +61,58 @@ func RealPing(coreType string, results []*Result) {
 			dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:"+strconv.Itoa(result.Port), nil, proxy.Direct)
 			if err != nil {
 				log.HandleDebug("set socks5 proxy: " + err.Error())
+				result.Reason = err.Error()
 				return
 			}
 			start := time.Now()
-			for {
-				result.Value = startTest(dialer)
-				if time.Since(start) > 4*time.Second || result.Value > -1 {
+			for retries := 0; ; retries++ {
+				result.FirstByte, result.Value, err = startTest(dialer, time.Duration(builds.Config.Speedtest.Timeout)*time.Millisecond)
+				if err != nil {
+					result.Reason = err.Error()
+				} else {
+					result.Reason = ""
+				}
+				if result.Value > -1 || time.Since(start) > time.Duration(builds.Config.Speedtest.RetryWindow)*time.Millisecond {
 					break
 				}
+				if builds.Config.Speedtest.Retries > 0 && retries >= builds.Config.Speedtest.Retries {
+					break
+				}
+			}
+			if result.Value > -1 && builds.Config.Speedtest.ExitIp {
+				if result.ExitIp, err = ExitIp(dialer); err != nil {
+					log.HandleDebug(err)
+				}
 			}
-			return
 		}(result)
 	}
 	wg.Wait()
+	if builds.Config.Speedtest.ExitIp {
+		locate(service.results)
+	}
+}
+
+// PingSocks test realping through a local socks5 inbound, return -1 if failed
+func PingSocks(port string, timeout time.Duration) int {
+	dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:"+port, nil, proxy.Direct)
+	if err != nil {
+		log.HandleDebug("set socks5 proxy: " + err.Error())
+		return -1
+	}
+	_, value, _ := startTest(dialer, timeout)
+	return value
 }
 
-func startTest(dialer proxy.Dialer) (result int) {
-	result = -1
+// startTest request the test url through dialer within timeout, return the first-byte and total time (ms), and the failure reason
+func startTest(dialer proxy.Dialer, timeout time.Duration) (firstByte int, total int, err error) {
+	firstByte, total = -1, -1
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// the dial is canceled with request timeout
+			if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+				return contextDialer.DialContext(ctx, network, addr)
+			}
 			return dialer.Dial(network, addr)
 		},
 		ForceAttemptHTTP2:     true,
@@ -86,13 +121,26 @@ func startTest(dialer proxy.Dialer) (result int) {
 		TLSHandshakeTimeout:   3 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
-	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: timeout}
 	// start test
-	request, _ := http.NewRequest("GET", testUrl, nil)
+	request, err := http.NewRequest("GET", builds.Config.Speedtest.Url, nil)
+	if err != nil {
+		err = e.New("create test request failed, ", err).WithPrefix(tagSpeedtest)
+		log.HandleDebug(err)
+		return
+	}
+	var first time.Duration
 	start := time.Now()
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			first = time.Since(start)
+		},
+	}))
 	response, err := client.Do(request)
 	if err != nil {
-		log.HandleDebug("request google_204: " + err.Error())
+		err = e.New("request "+builds.Config.Speedtest.Url+" failed, ", err).WithPrefix(tagSpeedtest)
+		log.HandleDebug(err)
 		return
 	}
 	// defer close body
@@ -100,34 +148,120 @@ func startTest(dialer proxy.Dialer) (result int) {
 		_ = Body.Close()
 	}(response.Body)
 	// get result
-	if response.StatusCode != 204 {
-		log.HandleDebug("request google_204 get " + strconv.Itoa(response.StatusCode))
+	if builds.Config.Speedtest.Status > 0 && response.StatusCode != builds.Config.Speedtest.Status {
+		err = e.New("request " + builds.Config.Speedtest.Url + " get " + strconv.Itoa(response.StatusCode)).WithPrefix(tagSpeedtest)
+		log.HandleDebug(err)
+		return
+	}
+	if _, err = io.Copy(io.Discard, response.Body); err != nil {
+		err = e.New("read "+builds.Config.Speedtest.Url+" failed, ", err).WithPrefix(tagSpeedtest)
+		log.HandleDebug(err)
 		return
 	}
-	result = int(time.Since(start).Milliseconds())
+	return int(first.Milliseconds()), int(time.Since(start).Milliseconds()), nil
+}
+
+// testService the test cores started for a batch of results
+type testService struct {
+	cores   []*testCore
+	results []*Result
+}
+
+// testCore a test core process, its config file and the results it serves
+type testCore struct {
+	service    common.External
+	configPath string
+	results    []*Result
+}
+
+// runTestService start test service for results, and wait until all inbounds are listening
+func runTestService(coreType string, results []*Result) (*testService, error) {
+	service, err := startTestService(coreType, results)
+	if err != nil {
+		return nil, err
+	}
+	for _, core := range service.cores {
+		for _, result := range core.results {
+			if common.CheckLocalPort(strconv.Itoa(core.service.Pid()), strconv.Itoa(result.Port), time.Duration(builds.Config.Speedtest.ListenWait)*time.Millisecond) {
+				continue
+			}
+			stopTestService(service)
+			return nil, e.New("test service not listen port " + strconv.Itoa(result.Port)).WithPrefix(tagSpeedtest)
+		}
+	}
+	return service, nil
+}
+
+// testable filter the results which can be converted to the outbound of coreType
+func testable(coreType string, results []*Result) (served []*Result) {
+	for _, result := range results {
+		if _, err := result.Url.ToOutboundWithTag(coreType, "test"); err != nil {
+			log.HandleDebug(err)
+			result.Reason = err.Error()
+			continue
+		}
+		served = append(served, result)
+	}
 	return
 }
 
-func startTestService(coreType string, configPath string, results []*Result) (common.External, error) {
-	var service common.External
+func startTestService(coreType string, results []*Result) (*testService, error) {
+	service := &testService{results: testable(coreType, results)}
+	if len(service.results) == 0 {
+		return nil, e.New("no node can be tested by coreType " + coreType).WithPrefix(tagSpeedtest)
+	}
 	switch coreType {
 	case "xray":
-		if err := genXrayTestConfig(configPath, results); err != nil {
+		configPath := path.Join(builds.Config.XrayHelper.RunDir, "test.json")
+		if err := genXrayTestConfig(configPath, service.results); err != nil {
 			return nil, err
 		}
-		service = common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "run", "-c", configPath)
+		service.cores = append(service.cores, &testCore{configPath: configPath, results: service.results,
+			service: common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "run", "-c", configPath)})
+	case "v2ray":
+		configPath := path.Join(builds.Config.XrayHelper.RunDir, "test.json")
+		if err := genV2rayTestConfig(configPath, service.results); err != nil {
+			return nil, err
+		}
+		service.cores = append(service.cores, &testCore{configPath: configPath, results: service.results,
+			service: common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "run", "-c", configPath, "-format", "jsonv5")})
 	case "sing-box":
-		if err := genSingboxTestConfig(configPath, results); err != nil {
+		configPath := path.Join(builds.Config.XrayHelper.RunDir, "test.json")
+		if err := genSingboxTestConfig(configPath, service.results); err != nil {
+			return nil, err
+		}
+		service.cores = append(service.cores, &testCore{configPath: configPath, results: service.results,
+			service: common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "run", "-c", configPath, "--disable-color")})
+	case "mihomo":
+		configPath := path.Join(builds.Config.XrayHelper.RunDir, "test.yaml")
+		if err := genMihomoTestConfig(configPath, service.results); err != nil {
 			return nil, err
 		}
-		service = common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "run", "-c", configPath, "--disable-color")
+		service.cores = append(service.cores, &testCore{configPath: configPath, results: service.results,
+			service: common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "-d", builds.Config.XrayHelper.RunDir, "-f", configPath)})
+	case "hysteria2":
+		// hysteria2 client only connect one server, start one process per node
+		for _, result := range service.results {
+			configPath := path.Join(builds.Config.XrayHelper.RunDir, "test-"+strconv.Itoa(result.Port)+".yaml")
+			if err := genHysteria2TestConfig(configPath, result); err != nil {
+				stopTestService(service)
+				return nil, err
+			}
+			service.cores = append(service.cores, &testCore{configPath: configPath, results: []*Result{result},
+				service: common.NewExternal(0, nil, nil, builds.Config.XrayHelper.CorePath, "-c", configPath)})
+		}
 	default:
 		return nil, e.New("not a supported coreType " + coreType).WithPrefix(tagSpeedtest)
 	}
-	service.SetUidGid("0", common.CoreGid)
-	service.Start()
-	if service.Err() != nil {
-		return nil, e.New("start test service failed, ", service.Err()).WithPrefix(tagSpeedtest)
+	for _, core := range service.cores {
+		core.service.SetUidGid("0", common.CoreGid)
+		core.service.Start()
+		if core.service.Err() != nil {
+			err := core.service.Err()
+			core.service = nil
+			stopTestService(service)
+			return nil, e.New("start test service failed, ", err).WithPrefix(tagSpeedtest)
+		}
 	}
 	return service, nil
 }
@@ -150,7 +284,7 @@ func genXrayTestConfig(configPath string, results []*Result) error {
 	}
 	dnsObj.Set("hosts", dnsHostsObj)
 	var dnsServersArr serial.OrderedArray
-	dnsServersArr = append(dnsServersArr, "223.5.5.5")
+	dnsServersArr = append(dnsServersArr, builds.Config.Speedtest.DNS)
 	dnsObj.Set("servers", dnsServersArr)
 	config.Set("dns", dnsObj)
 	// add inbounds
@@ -161,6 +295,11 @@ func genXrayTestConfig(configPath string, results []*Result) error {
 		socksObj.Set("tag", tag)
 		socksObj.Set("port", result.Port)
 		socksObj.Set("protocol", "socks")
+		// enable udp associate for udp test
+		var settingsObj serial.OrderedMap
+		settingsObj.Set("udp", true)
+		settingsObj.Set("ip", "127.0.0.1")
+		socksObj.Set("settings", settingsObj)
 
 		var sniffingObj serial.OrderedMap
 		sniffingObj.Set("enabled", true)
@@ -216,7 +355,7 @@ func genSingboxTestConfig(configPath string, results []*Result) error {
 	var dnsObj serial.OrderedMap
 	var dnsServersArr serial.OrderedArray
 	var dnsServerObj serial.OrderedMap
-	dnsServerObj.Set("address", "223.5.5.5")
+	dnsServerObj.Set("address", builds.Config.Speedtest.DNS)
 	dnsServerObj.Set("detour", "direct")
 	dnsServersArr = append(dnsServersArr, dnsServerObj)
 	dnsObj.Set("servers", dnsServersArr)
@@ -277,7 +416,129 @@ func genSingboxTestConfig(configPath string, results []*Result) error {
 	return nil
 }
 
-func stopTestService(service common.External, configPath string) {
-	_ = service.Kill()
-	_ = os.Remove(configPath)
+func genV2rayTestConfig(configPath string, results []*Result) error {
+	var config serial.OrderedMap
+	// add inbounds
+	var inboundsArr serial.OrderedArray
+	for _, result := range results {
+		var socksObj serial.OrderedMap
+		socksObj.Set("tag", "in-"+strconv.Itoa(result.Port))
+		socksObj.Set("listen", "127.0.0.1")
+		socksObj.Set("port", result.Port)
+		socksObj.Set("protocol", "socks")
+		var settingsObj serial.OrderedMap
+		settingsObj.Set("udpEnabled", true)
+		settingsObj.Set("address", "127.0.0.1")
+		socksObj.Set("settings", settingsObj)
+		inboundsArr = append(inboundsArr, socksObj)
+	}
+	config.Set("inbounds", inboundsArr)
+	// add outbounds
+	var outboundsArr serial.OrderedArray
+	for i, result := range results {
+		outbound, err := result.Url.ToOutboundWithTag("v2ray", "out-"+strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+		outboundsArr = append(outboundsArr, outbound)
+	}
+	config.Set("outbounds", outboundsArr)
+	// add routing
+	var routing serial.OrderedMap
+	var rulesArr serial.OrderedArray
+	for i, result := range results {
+		var rule serial.OrderedMap
+		var inboundTag serial.OrderedArray
+		inboundTag = append(inboundTag, "in-"+strconv.Itoa(result.Port))
+		rule.Set("inboundTag", inboundTag)
+		rule.Set("tag", "out-"+strconv.Itoa(i))
+		rulesArr = append(rulesArr, rule)
+	}
+	routing.Set("rule", rulesArr)
+	config.Set("router", routing)
+	// save test config
+	marshal, err := json.Marshal(config)
+	if err != nil {
+		return e.New("marshal v2ray test config failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	if err := os.WriteFile(configPath, marshal, 0644); err != nil {
+		return e.New("write v2ray test config failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	return nil
+}
+
+func genMihomoTestConfig(configPath string, results []*Result) error {
+	var config serial.OrderedMap
+	config.Set("mode", "rule")
+	config.Set("log-level", "silent")
+	// add dns
+	var dnsObj serial.OrderedMap
+	dnsObj.Set("enable", true)
+	var nameserverArr serial.OrderedArray
+	nameserverArr = append(nameserverArr, builds.Config.Speedtest.DNS)
+	dnsObj.Set("nameserver", nameserverArr)
+	config.Set("dns", dnsObj)
+	// add proxies
+	var proxiesArr serial.OrderedArray
+	for i, result := range results {
+		proxy, err := result.Url.ToOutboundWithTag("mihomo", "out-"+strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+		proxiesArr = append(proxiesArr, proxy)
+	}
+	config.Set("proxies", proxiesArr)
+	// add listeners, one listener per proxy
+	var listenersArr serial.OrderedArray
+	for i, result := range results {
+		var socksObj serial.OrderedMap
+		socksObj.Set("name", "in-"+strconv.Itoa(result.Port))
+		socksObj.Set("type", "socks")
+		socksObj.Set("listen", "127.0.0.1")
+		socksObj.Set("port", result.Port)
+		socksObj.Set("udp", true)
+		socksObj.Set("proxy", "out-"+strconv.Itoa(i))
+		listenersArr = append(listenersArr, socksObj)
+	}
+	config.Set("listeners", listenersArr)
+	var rulesArr serial.OrderedArray
+	rulesArr = append(rulesArr, "MATCH,DIRECT")
+	config.Set("rules", rulesArr)
+	// save test config
+	marshal, err := yaml.Marshal(config)
+	if err != nil {
+		return e.New("marshal mihomo test config failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	if err := os.WriteFile(configPath, marshal, 0644); err != nil {
+		return e.New("write mihomo test config failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	return nil
+}
+
+func genHysteria2TestConfig(configPath string, result *Result) error {
+	config, err := result.Url.ToOutboundWithTag("hysteria2", "")
+	if err != nil {
+		return err
+	}
+	var socks5Obj serial.OrderedMap
+	socks5Obj.Set("listen", "127.0.0.1:"+strconv.Itoa(result.Port))
+	config.Set("socks5", socks5Obj)
+	// save test config
+	marshal, err := yaml.Marshal(config)
+	if err != nil {
+		return e.New("marshal hysteria2 test config failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	if err := os.WriteFile(configPath, marshal, 0644); err != nil {
+		return e.New("write hysteria2 test config failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	return nil
+}
+
+func stopTestService(service *testService) {
+	for _, core := range service.cores {
+		if core.service != nil {
+			_ = core.service.Kill()
+		}
+		_ = os.Remove(core.configPath)
+	}
 }
@@ -0,0 +1,80 @@
+package shareurls
+
+import (
+	"XrayHelper/main/builds"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
+	"XrayHelper/main/shareurls/addon"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// TCPing measure the tcp connect time (Value) and the time including tls handshake (Total) of results directly, without core
+func TCPing(results []*Result) {
+	parallel := builds.Config.Speedtest.TcpingParallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	semaphore := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, result := range results {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(result *Result) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			var err error
+			if result.Value, result.Total, err = tcping(result.Url.GetNodeInfo()); err != nil {
+				log.HandleDebug(err)
+				result.Reason = err.Error()
+			}
+		}(result)
+	}
+	wg.Wait()
+}
+
+// CanTCPing whether the node can be tested by tcping, udp based nodes cannot
+func CanTCPing(info *addon.NodeInfo) bool {
+	switch info.Type {
+	case "Hysteria", "Hysteria2", "Wireguard":
+		return false
+	}
+	return true
+}
+
+// tcping connect to the node server, and finish tls handshake if node use tls
+func tcping(info *addon.NodeInfo) (connect int, total int, err error) {
+	connect, total = -1, -1
+	if !CanTCPing(info) {
+		return connect, total, e.New(info.Type + " node is udp based, not support tcping").WithPrefix(tagSpeedtest)
+	}
+	timeout := time.Duration(builds.Config.Speedtest.Timeout) * time.Millisecond
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(info.Host, info.Port), timeout)
+	if err != nil {
+		return connect, total, e.New("connect "+info.Host+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	connect = int(time.Since(start).Milliseconds())
+	// reality cannot be handshook without its key, only test tcp
+	if info.Security != "tls" {
+		return connect, connect, nil
+	}
+	serverName := info.Sni
+	if len(serverName) == 0 {
+		serverName = info.Host
+	}
+	// only measure the handshake time, the certificate is verified by core
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	_ = tlsConn.SetDeadline(start.Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return connect, total, e.New("tls handshake with "+serverName+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	return connect, int(time.Since(start).Milliseconds()), nil
+}
@@ -0,0 +1,50 @@
+package shareurls_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/log"
+	"XrayHelper/main/shareurls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTCPing(t *testing.T) {
+	verbose := false
+	log.Verbose = &verbose
+	builds.Config.Speedtest.Timeout = 3000
+	builds.Config.Speedtest.TcpingParallel = 2
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, closedPort, _ := net.SplitHostPort(closed.Addr().String())
+	_ = closed.Close()
+	var results []*shareurls.Result
+	for _, link := range []string{
+		"trojan://pass@" + host + ":" + port + "?security=tls&sni=example.com#tls",
+		"socks://" + host + ":" + port + "#tcp",
+		"trojan://pass@" + host + ":" + closedPort + "?security=tls#closed",
+		"hysteria2://auth@" + host + ":" + port + "#udp",
+	} {
+		url, err := shareurls.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, &shareurls.Result{Url: url, Value: -1, Total: -1})
+	}
+	shareurls.TCPing(results)
+	if results[0].Value < 0 || results[0].Total < results[0].Value {
+		t.Errorf("expect tls node handshake success, got %+v", results[0])
+	}
+	if results[1].Value < 0 || results[1].Total != results[1].Value {
+		t.Errorf("expect tcp node connect success, got %+v", results[1])
+	}
+	if results[2].Value != -1 || len(results[2].Reason) == 0 {
+		t.Errorf("expect closed port failed, got %+v", results[2])
+	}
+	if results[3].Value != -1 || len(results[3].Reason) == 0 {
+		t.Errorf("expect udp node not supported, got %+v", results[3])
+	}
+}
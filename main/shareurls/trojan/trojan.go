@@ -26,11 +26,14 @@ type Trojan struct {
 
 func (this *Trojan) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("Trojan", this.Server, this.Port, this.Password),
 		Remarks:  this.Remarks,
 		Type:     "Trojan",
 		Host:     this.Server,
 		Port:     this.Port,
 		Protocol: this.Network,
+		Security: this.Security,
+		Sni:      this.Addon.Sni,
 	}
 }
 
@@ -59,6 +62,36 @@ func (this *Trojan) ToOutboundWithTag(coreType string, tag string) (*serial.Orde
 		outboundObject.Set("tls", addon.GetTlsObjectSingbox(&this.Addon, this.Security))
 		outboundObject.Set("transport", addon.GetTransportObjectSingbox(&this.Addon, this.Network))
 		return &outboundObject, nil
+	case "v2ray":
+		streamSettingsObject, err := addon.GetStreamSettingsObjectV2ray(&this.Addon, this.Network, this.Security)
+		if err != nil {
+			return nil, err
+		}
+		var settingsObject serial.OrderedMap
+		settingsObject.Set("address", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		settingsObject.Set("port", port)
+		settingsObject.Set("password", this.Password)
+		var outboundObject serial.OrderedMap
+		outboundObject.Set("protocol", "trojan")
+		outboundObject.Set("settings", settingsObject)
+		outboundObject.Set("streamSettings", streamSettingsObject)
+		outboundObject.Set("tag", tag)
+		return &outboundObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "trojan")
+		proxyObject.Set("server", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		proxyObject.Set("password", this.Password)
+		proxyObject.Set("udp", true)
+		addon.SetTlsObjectMihomo(&this.Addon, this.Security, "sni", &proxyObject)
+		if err := addon.SetTransportObjectMihomo(&this.Addon, this.Network, &proxyObject); err != nil {
+			return nil, err
+		}
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagTrojan).WithPathObj(*this)
 	}
@@ -0,0 +1,221 @@
+package shareurls
+
+import (
+	"XrayHelper/main/builds"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UdpTest test the udp support of results through the test service
+func UdpTest(coreType string, results []*Result) {
+	service, err := runTestService(coreType, results)
+	if err != nil {
+		log.HandleDebug(err)
+		for _, result := range results {
+			if len(result.Reason) == 0 {
+				result.Reason = err.Error()
+			}
+		}
+		return
+	}
+	defer stopTestService(service)
+	var wg sync.WaitGroup
+	for _, result := range service.results {
+		wg.Add(1)
+		go func(result *Result) {
+			defer wg.Done()
+			var err error
+			if result.Udp, err = UdpAssociate("127.0.0.1:" + strconv.Itoa(result.Port)); err != nil {
+				log.HandleDebug(err)
+				result.Reason = err.Error()
+			}
+		}(result)
+	}
+	wg.Wait()
+}
+
+// UdpAssociate send a dns query (or echo payload if udpDomain is empty) to udpTarget by socks5 udp associate,
+// return the round-trip time (ms)
+func UdpAssociate(socksAddr string) (int, error) {
+	timeout := time.Duration(builds.Config.Speedtest.Timeout) * time.Millisecond
+	target := builds.Config.Speedtest.UdpTarget
+	header, err := socksUdpHeader(target)
+	if err != nil {
+		return -1, err
+	}
+	// the udp association terminates when the tcp connection closed
+	conn, err := net.DialTimeout("tcp", socksAddr, timeout)
+	if err != nil {
+		return -1, e.New("connect socks5 "+socksAddr+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	relay, err := socksAssociate(conn)
+	if err != nil {
+		return -1, err
+	}
+	udpConn, err := net.Dial("udp", relay)
+	if err != nil {
+		return -1, e.New("connect udp relay "+relay+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	defer func(udpConn net.Conn) {
+		_ = udpConn.Close()
+	}(udpConn)
+	_ = udpConn.SetDeadline(time.Now().Add(timeout))
+	payload, check := udpPayload(builds.Config.Speedtest.UdpDomain)
+	start := time.Now()
+	if _, err := udpConn.Write(append(header, payload...)); err != nil {
+		return -1, e.New("send udp packet to "+target+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	buf := make([]byte, 65535)
+	n, err := udpConn.Read(buf)
+	if err != nil {
+		return -1, e.New("receive udp packet from "+target+" failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	rtt := int(time.Since(start).Milliseconds())
+	response, err := stripSocksUdpHeader(buf[:n])
+	if err != nil {
+		return -1, err
+	}
+	if !check(response) {
+		return -1, e.New("receive unexpected udp packet from " + target).WithPrefix(tagSpeedtest)
+	}
+	return rtt, nil
+}
+
+// socksAssociate negotiate a no-auth socks5 udp associate, return the relay address
+func socksAssociate(conn net.Conn) (string, error) {
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return "", e.New("socks5 handshake failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return "", e.New("socks5 handshake failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	if reply[0] != 0x05 || reply[1] != 0x00 {
+		return "", e.New("socks5 handshake failed, unsupported auth method").WithPrefix(tagSpeedtest)
+	}
+	if _, err := conn.Write([]byte{0x05, 0x03, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return "", e.New("socks5 udp associate failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	reply = make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return "", e.New("socks5 udp associate failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	if reply[1] != 0x00 {
+		return "", e.New("socks5 udp associate failed, reply code " + strconv.Itoa(int(reply[1]))).WithPrefix(tagSpeedtest)
+	}
+	host, err := readSocksAddr(conn, reply[3])
+	if err != nil {
+		return "", err
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", e.New("socks5 udp associate failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	// some servers reply the unspecified address, use the address of tcp connection instead
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// readSocksAddr read the socks5 address of atyp
+func readSocksAddr(reader io.Reader, atyp byte) (string, error) {
+	var addr []byte
+	switch atyp {
+	case 0x01:
+		addr = make([]byte, net.IPv4len)
+	case 0x04:
+		addr = make([]byte, net.IPv6len)
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(reader, length); err != nil {
+			return "", e.New("read socks5 address failed, ", err).WithPrefix(tagSpeedtest)
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(reader, domain); err != nil {
+			return "", e.New("read socks5 address failed, ", err).WithPrefix(tagSpeedtest)
+		}
+		return string(domain), nil
+	default:
+		return "", e.New("unknown socks5 address type " + strconv.Itoa(int(atyp))).WithPrefix(tagSpeedtest)
+	}
+	if _, err := io.ReadFull(reader, addr); err != nil {
+		return "", e.New("read socks5 address failed, ", err).WithPrefix(tagSpeedtest)
+	}
+	return net.IP(addr).String(), nil
+}
+
+// socksUdpHeader build the socks5 udp request header of target
+func socksUdpHeader(target string) ([]byte, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, e.New("invalid udp target "+target+", ", err).WithPrefix(tagSpeedtest)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, e.New("invalid udp target "+target+", ", err).WithPrefix(tagSpeedtest)
+	}
+	header := []byte{0x00, 0x00, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			header = append(append(header, 0x01), ip4...)
+		} else {
+			header = append(append(header, 0x04), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, e.New("invalid udp target " + target + ", domain too long").WithPrefix(tagSpeedtest)
+		}
+		header = append(append(header, 0x03, byte(len(host))), host...)
+	}
+	return binary.BigEndian.AppendUint16(header, uint16(portNum)), nil
+}
+
+// stripSocksUdpHeader return the payload of socks5 udp packet
+func stripSocksUdpHeader(packet []byte) ([]byte, error) {
+	if len(packet) < 4 || packet[2] != 0x00 {
+		return nil, e.New("receive invalid socks5 udp packet").WithPrefix(tagSpeedtest)
+	}
+	reader := bytes.NewReader(packet[4:])
+	if _, err := readSocksAddr(reader, packet[3]); err != nil {
+		return nil, err
+	}
+	if _, err := reader.Seek(2, io.SeekCurrent); err != nil || reader.Len() == 0 {
+		return nil, e.New("receive invalid socks5 udp packet").WithPrefix(tagSpeedtest)
+	}
+	return packet[len(packet)-reader.Len():], nil
+}
+
+// udpPayload build a dns query of domain, or a random echo payload if domain is empty, and the response checker
+func udpPayload(domain string) ([]byte, func(response []byte) bool) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	if len(domain) == 0 {
+		return id, func(response []byte) bool {
+			return bytes.Equal(response, id)
+		}
+	}
+	// header: id, recursion desired, one question
+	query := append(id[:2:2], 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	for _, label := range strings.Split(strings.Trim(domain, "."), ".") {
+		query = append(append(query, byte(len(label))), label...)
+	}
+	// type A, class IN
+	query = append(query, 0x00, 0x00, 0x01, 0x00, 0x01)
+	return query, func(response []byte) bool {
+		return len(response) >= 12 && bytes.Equal(response[:2], id[:2]) && response[2]&0x80 != 0
+	}
+}
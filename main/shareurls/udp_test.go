@@ -0,0 +1,123 @@
+package shareurls_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/log"
+	"XrayHelper/main/shareurls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// udpServer a udp echo server, or a dns stand-in which answers every query with empty response
+func udpServer(t *testing.T, dns bool) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if dns && n >= 12 {
+				buf[2] |= 0x80
+			}
+			_, _ = conn.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return conn
+}
+
+// socksServer a minimal socks5 server which only supports udp associate with ipv4 target
+func socksServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 10)
+				if _, err := io.ReadFull(conn, buf[:3]); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte{0x05, 0x00})
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					return
+				}
+				relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				if err != nil {
+					return
+				}
+				defer relay.Close()
+				reply := binary.BigEndian.AppendUint16([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0}, uint16(relay.LocalAddr().(*net.UDPAddr).Port))
+				_, _ = conn.Write(reply)
+				go func() {
+					packet := make([]byte, 65535)
+					n, client, err := relay.ReadFromUDP(packet)
+					if err != nil || n < 10 {
+						return
+					}
+					target := &net.UDPAddr{IP: net.IP(packet[4:8]), Port: int(binary.BigEndian.Uint16(packet[8:10]))}
+					upstream, err := net.DialUDP("udp", nil, target)
+					if err != nil {
+						return
+					}
+					defer upstream.Close()
+					_, _ = upstream.Write(packet[10:n])
+					response := make([]byte, 65535)
+					m, err := upstream.Read(response)
+					if err != nil {
+						return
+					}
+					_, _ = relay.WriteToUDP(append(packet[:10:10], response[:m]...), client)
+				}()
+				_, _ = io.Copy(io.Discard, conn)
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+func TestUdpAssociate(t *testing.T) {
+	verbose := false
+	log.Verbose = &verbose
+	builds.Config.Speedtest.Timeout = 2000
+	socks := socksServer(t)
+	defer socks.Close()
+	echo := udpServer(t, false)
+	defer echo.Close()
+	dns := udpServer(t, true)
+	defer dns.Close()
+
+	builds.Config.Speedtest.UdpTarget = echo.LocalAddr().String()
+	builds.Config.Speedtest.UdpDomain = ""
+	if rtt, err := shareurls.UdpAssociate(socks.Addr().String()); err != nil || rtt < 0 {
+		t.Errorf("udp echo failed, rtt %d, %v", rtt, err)
+	}
+	builds.Config.Speedtest.UdpTarget = dns.LocalAddr().String()
+	builds.Config.Speedtest.UdpDomain = "www.google.com"
+	if rtt, err := shareurls.UdpAssociate(socks.Addr().String()); err != nil || rtt < 0 {
+		t.Errorf("udp dns failed, rtt %d, %v", rtt, err)
+	}
+	// the echo server returns the query without response flag
+	builds.Config.Speedtest.UdpTarget = echo.LocalAddr().String()
+	if _, err := shareurls.UdpAssociate(socks.Addr().String()); err == nil {
+		t.Errorf("expect unexpected response error")
+	}
+	// udp dropped, no response
+	builds.Config.Speedtest.Timeout = 300
+	builds.Config.Speedtest.UdpTarget = "127.0.0.1:9"
+	if _, err := shareurls.UdpAssociate(socks.Addr().String()); err == nil {
+		t.Errorf("expect timeout error")
+	}
+}
@@ -19,3 +19,54 @@ func TestVLESS(t *testing.T) {
 	indent, err := json.MarshalIndent(tag, "", "    ")
 	fmt.Println(string(indent))
 }
+
+func TestVLESSNodeId(t *testing.T) {
+	a, err := shareurls.Parse(testVLESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := shareurls.Parse("vless://6666-66666666-666666@1.com:443?security=none&type=tcp#renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetNodeInfo().Id != b.GetNodeInfo().Id {
+		t.Error("node id should not change with remarks and transport")
+	}
+	c, err := shareurls.Parse("vless://6666-66666666-666666@1.com:8443#other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetNodeInfo().Id == c.GetNodeInfo().Id {
+		t.Error("node id should change with port")
+	}
+}
+
+func TestVLESSOtherCores(t *testing.T) {
+	vlessShareUrl, err := shareurls.Parse(testVLESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := vlessShareUrl.ToOutboundWithTag("mihomo", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := proxy.Get("servername"); !ok || name.Value != "3.com" {
+		t.Errorf("expect mihomo servername 3.com, got %v", name)
+	}
+	if network, ok := proxy.Get("network"); !ok || network.Value != "h2" {
+		t.Errorf("expect mihomo network h2, got %v", network)
+	}
+	if _, err := vlessShareUrl.ToOutboundWithTag("v2ray", "proxy"); err == nil {
+		t.Error("expect v2ray not support xtls flow")
+	}
+	plain, err := shareurls.Parse("vless://6666-66666666-666666@1.com:443?security=tls&type=ws&path=%2Fws&sni=3.com#plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbound, err := plain.ToOutboundWithTag("v2ray", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indent, _ := json.MarshalIndent(outbound, "", "    ")
+	fmt.Println(string(indent))
+}
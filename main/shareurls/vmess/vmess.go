@@ -45,11 +45,14 @@ type Vmess struct {
 
 func (this *Vmess) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("VMess", string(this.Server), string(this.Port), string(this.Id)),
 		Remarks:  string(this.Remarks),
 		Type:     "VMess",
 		Host:     string(this.Server),
 		Port:     string(this.Port),
 		Protocol: string(this.Network),
+		Security: string(this.Tls),
+		Sni:      string(this.Sni),
 	}
 }
 
@@ -87,6 +90,43 @@ func (this *Vmess) ToOutboundWithTag(coreType string, tag string) (*serial.Order
 		outboundObject.Set("tls", addon.GetTlsObjectSingbox(addons, string(this.Tls)))
 		outboundObject.Set("transport", addon.GetTransportObjectSingbox(addons, string(this.Network)))
 		return &outboundObject, nil
+	case "v2ray":
+		streamSettingsObject, err := addon.GetStreamSettingsObjectV2ray(addons, string(this.Network), string(this.Tls))
+		if err != nil {
+			return nil, err
+		}
+		var settingsObject serial.OrderedMap
+		settingsObject.Set("address", string(this.Server))
+		port, _ := strconv.Atoi(string(this.Port))
+		settingsObject.Set("port", port)
+		settingsObject.Set("uuid", string(this.Id))
+		var outboundObject serial.OrderedMap
+		outboundObject.Set("protocol", "vmess")
+		outboundObject.Set("settings", settingsObject)
+		outboundObject.Set("streamSettings", streamSettingsObject)
+		outboundObject.Set("tag", tag)
+		return &outboundObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "vmess")
+		proxyObject.Set("server", string(this.Server))
+		port, _ := strconv.Atoi(string(this.Port))
+		proxyObject.Set("port", port)
+		proxyObject.Set("uuid", string(this.Id))
+		alterId, _ := strconv.Atoi(string(this.AlterId))
+		proxyObject.Set("alterId", alterId)
+		if len(this.Security) > 0 {
+			proxyObject.Set("cipher", string(this.Security))
+		} else {
+			proxyObject.Set("cipher", "auto")
+		}
+		proxyObject.Set("udp", true)
+		addon.SetTlsObjectMihomo(addons, string(this.Tls), "servername", &proxyObject)
+		if err := addon.SetTransportObjectMihomo(addons, string(this.Network), &proxyObject); err != nil {
+			return nil, err
+		}
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagVmess).WithPathObj(*this)
 	}
@@ -27,11 +27,14 @@ type VmessAEAD struct {
 
 func (this *VmessAEAD) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("VMess", this.Server, this.Port, this.Id),
 		Remarks:  this.Remarks,
 		Type:     "VMess",
 		Host:     this.Server,
 		Port:     this.Port,
 		Protocol: this.Network,
+		Security: this.Security,
+		Sni:      this.Addon.Sni,
 	}
 }
 
@@ -62,6 +65,42 @@ func (this *VmessAEAD) ToOutboundWithTag(coreType string, tag string) (*serial.O
 		outboundObject.Set("tls", addon.GetTlsObjectSingbox(&this.Addon, this.Security))
 		outboundObject.Set("transport", addon.GetTransportObjectSingbox(&this.Addon, this.Network))
 		return &outboundObject, nil
+	case "v2ray":
+		streamSettingsObject, err := addon.GetStreamSettingsObjectV2ray(&this.Addon, this.Network, this.Security)
+		if err != nil {
+			return nil, err
+		}
+		var settingsObject serial.OrderedMap
+		settingsObject.Set("address", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		settingsObject.Set("port", port)
+		settingsObject.Set("uuid", this.Id)
+		var outboundObject serial.OrderedMap
+		outboundObject.Set("protocol", "vmess")
+		outboundObject.Set("settings", settingsObject)
+		outboundObject.Set("streamSettings", streamSettingsObject)
+		outboundObject.Set("tag", tag)
+		return &outboundObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "vmess")
+		proxyObject.Set("server", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		proxyObject.Set("uuid", this.Id)
+		proxyObject.Set("alterId", 0)
+		if len(this.Encryption) > 0 {
+			proxyObject.Set("cipher", this.Encryption)
+		} else {
+			proxyObject.Set("cipher", "auto")
+		}
+		proxyObject.Set("udp", true)
+		addon.SetTlsObjectMihomo(&this.Addon, this.Security, "servername", &proxyObject)
+		if err := addon.SetTransportObjectMihomo(&this.Addon, this.Network, &proxyObject); err != nil {
+			return nil, err
+		}
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagVmessAEAD).WithPathObj(*this)
 	}
@@ -6,6 +6,7 @@ import (
 	"XrayHelper/main/shareurls/addon"
 	"fmt"
 	"github.com/fatih/color"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -25,6 +26,7 @@ type Wireguard struct {
 
 func (this *Wireguard) GetNodeInfo() *addon.NodeInfo {
 	return &addon.NodeInfo{
+		Id:       addon.NodeId("Wireguard", this.Server, this.Port, this.SecretKey, this.PublicKey),
 		Remarks:  this.Remarks,
 		Type:     "Wireguard",
 		Host:     this.Server,
@@ -74,6 +76,38 @@ func (this *Wireguard) ToOutboundWithTag(coreType string, tag string) (*serial.O
 			outboundObject.Set("mtu", mtu)
 		}
 		return &outboundObject, nil
+	case "mihomo":
+		var proxyObject serial.OrderedMap
+		proxyObject.Set("name", tag)
+		proxyObject.Set("type", "wireguard")
+		proxyObject.Set("server", this.Server)
+		port, _ := strconv.Atoi(this.Port)
+		proxyObject.Set("port", port)
+		for _, address := range strings.Split(this.Address, ",") {
+			if ip := net.ParseIP(strings.Split(strings.TrimSpace(address), "/")[0]); ip != nil {
+				if ip.To4() != nil {
+					proxyObject.Set("ip", ip.String())
+				} else {
+					proxyObject.Set("ipv6", ip.String())
+				}
+			}
+		}
+		proxyObject.Set("private-key", this.SecretKey)
+		proxyObject.Set("public-key", this.PublicKey)
+		if len(this.Reserved) > 0 {
+			var reservedArr serial.OrderedArray
+			for _, id := range strings.Split(this.Reserved, ",") {
+				iid, _ := strconv.Atoi(id)
+				reservedArr = append(reservedArr, iid)
+			}
+			proxyObject.Set("reserved", reservedArr)
+		}
+		if len(this.Mtu) > 0 {
+			mtu, _ := strconv.Atoi(this.Mtu)
+			proxyObject.Set("mtu", mtu)
+		}
+		proxyObject.Set("udp", true)
+		return &proxyObject, nil
 	default:
 		return nil, e.New("unsupported core type " + coreType).WithPrefix(tagWireguard).WithPathObj(*this)
 	}
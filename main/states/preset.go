@@ -0,0 +1,23 @@
+package states
+
+const presetFile = "preset.json"
+
+// AppliedPreset the applied version of preset and the rules it added, every rule is kept as compact json
+type AppliedPreset struct {
+	Version int      `json:"version"`
+	Rules   []string `json:"rules"`
+}
+
+// Preset the persisted applied presets, key is preset name
+var Preset map[string]AppliedPreset
+
+// LoadPreset load applied presets from DataDir
+func LoadPreset() error {
+	Preset = make(map[string]AppliedPreset)
+	return load(presetFile, &Preset)
+}
+
+// SavePreset save applied presets to DataDir
+func SavePreset() error {
+	return save(presetFile, &Preset)
+}
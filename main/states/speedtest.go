@@ -0,0 +1,98 @@
+package states
+
+import (
+	"sort"
+)
+
+const (
+	speedtestFile = "speedtest.json"
+	maxRecords    = 10
+)
+
+// Record the realping record of node, Realping is -1 if failed, ExitIp and Country are set if detected
+type Record struct {
+	Time     int64  `json:"time"`
+	Realping int    `json:"realping"`
+	ExitIp   string `json:"exitIp,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Speedtest the persisted realping history, key is node id, the latest record is the last one
+var Speedtest map[string][]Record
+
+// LoadSpeedtest load speedtest history from DataDir
+func LoadSpeedtest() error {
+	Speedtest = make(map[string][]Record)
+	return load(speedtestFile, &Speedtest)
+}
+
+// SaveSpeedtest save speedtest history to DataDir
+func SaveSpeedtest() error {
+	return save(speedtestFile, &Speedtest)
+}
+
+// AddRecord append a record of node, only keep the latest records
+func AddRecord(id string, record Record) {
+	records := append(Speedtest[id], record)
+	if len(records) > maxRecords {
+		records = records[len(records)-maxRecords:]
+	}
+	Speedtest[id] = records
+}
+
+// Latest get the latest record of node, nil if never tested
+func Latest(id string) *Record {
+	if records := Speedtest[id]; len(records) > 0 {
+		return &records[len(records)-1]
+	}
+	return nil
+}
+
+// Located get the latest record of node which has exit ip, nil if never detected
+func Located(id string) *Record {
+	records := Speedtest[id]
+	for i := len(records) - 1; i >= 0; i-- {
+		if len(records[i].ExitIp) > 0 {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// Failed check whether the node failed the last n tests
+func Failed(id string, n int) bool {
+	records := Speedtest[id]
+	if n <= 0 || len(records) < n {
+		return false
+	}
+	for _, record := range records[len(records)-n:] {
+		if record.Realping >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Order get the node indexes for listing, hide the nodes failed the last hideFailed tests,
+// and sort by the latest realping if needed, failed and untested nodes are at the end
+func Order(ids []string, sortByRealping bool, hideFailed int) []int {
+	var order []int
+	for index, id := range ids {
+		if !Failed(id, hideFailed) {
+			order = append(order, index)
+		}
+	}
+	if sortByRealping {
+		latency := func(index int) int {
+			if latest := Latest(ids[index]); latest != nil && latest.Realping >= 0 {
+				return latest.Realping
+			}
+			return int(^uint(0) >> 1)
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return latency(order[i]) < latency(order[j])
+		})
+	}
+	return order
+}
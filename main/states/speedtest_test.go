@@ -0,0 +1,32 @@
+package states_test
+
+import (
+	"XrayHelper/main/states"
+	"reflect"
+	"testing"
+)
+
+func TestOrder(t *testing.T) {
+	states.Speedtest = make(map[string][]states.Record)
+	states.AddRecord("a", states.Record{Realping: 300})
+	states.AddRecord("b", states.Record{Realping: -1, Reason: "timeout"})
+	states.AddRecord("b", states.Record{Realping: -1, Reason: "timeout"})
+	states.AddRecord("c", states.Record{Realping: -1})
+	states.AddRecord("c", states.Record{Realping: 100})
+	ids := []string{"a", "b", "c", "d"}
+	if order := states.Order(ids, false, 0); !reflect.DeepEqual(order, []int{0, 1, 2, 3}) {
+		t.Errorf("expect original order, got %v", order)
+	}
+	if order := states.Order(ids, true, 0); !reflect.DeepEqual(order, []int{2, 0, 1, 3}) {
+		t.Errorf("expect sorted by realping, got %v", order)
+	}
+	if order := states.Order(ids, true, 2); !reflect.DeepEqual(order, []int{2, 0, 3}) {
+		t.Errorf("expect node failed twice hidden, got %v", order)
+	}
+	for i := 0; i < 20; i++ {
+		states.AddRecord("a", states.Record{Realping: i})
+	}
+	if len(states.Speedtest["a"]) != 10 || states.Latest("a").Realping != 19 {
+		t.Errorf("expect only latest records kept, got %v", states.Speedtest["a"])
+	}
+}
@@ -0,0 +1,76 @@
+package states
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+)
+
+const (
+	tagStates  = "states"
+	switchFile = "switch.json"
+)
+
+// Node the persisted node identity, index will be re-resolved by id when subscribe changed, via is the relay node of proxy chain
+type Node struct {
+	Id     string `json:"id"`
+	Custom bool   `json:"custom"`
+	Index  int    `json:"index"`
+	Via    *Node  `json:"via,omitempty"`
+}
+
+// Switch the persisted switch state, include the current node of proxyTag and each of proxyTags, the nodes of group and the nodes referenced by routes
+var Switch struct {
+	Current *Node           `json:"current,omitempty"`
+	Tags    map[string]Node `json:"tags,omitempty"`
+	Group   []Node          `json:"group,omitempty"`
+	Routes  map[string]Node `json:"routes,omitempty"`
+}
+
+// LoadSwitch load switch state from DataDir
+func LoadSwitch() error {
+	Switch.Current = nil
+	Switch.Tags = make(map[string]Node)
+	Switch.Group = nil
+	Switch.Routes = make(map[string]Node)
+	return load(switchFile, &Switch)
+}
+
+// SaveSwitch save switch state to DataDir
+func SaveSwitch() error {
+	return save(switchFile, &Switch)
+}
+
+// load unmarshal state file, a nonexistent file means empty state
+func load(name string, v any) error {
+	stateByte, err := os.ReadFile(path.Join(builds.Config.XrayHelper.DataDir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return e.New("read state file "+name+" failed, ", err).WithPrefix(tagStates)
+	}
+	if err := json.Unmarshal(stateByte, v); err != nil {
+		return e.New("unmarshal state file "+name+" failed, ", err).WithPrefix(tagStates)
+	}
+	return nil
+}
+
+// save marshal state into file, nothing is saved in dry run
+func save(name string, v any) error {
+	if common.DryRun {
+		return nil
+	}
+	marshal, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return e.New("marshal state file "+name+" failed, ", err).WithPrefix(tagStates)
+	}
+	if err := os.WriteFile(path.Join(builds.Config.XrayHelper.DataDir, name), marshal, 0644); err != nil {
+		return e.New("write state file "+name+" failed, ", err).WithPrefix(tagStates)
+	}
+	return nil
+}
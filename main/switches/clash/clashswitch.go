@@ -3,21 +3,35 @@ package clash
 import (
 	"XrayHelper/main/builds"
 	"XrayHelper/main/common"
+	"XrayHelper/main/controller"
 	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
 	"XrayHelper/main/serial"
+	"XrayHelper/main/shareurls"
 	"fmt"
 	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 )
 
-const tagClashswitch = "clashswitch"
+const (
+	tagClashswitch = "clashswitch"
+	// chainProxy the proxy name of chain in proxyTag group, its relay is named by shareurls.RelayTag
+	chainProxy = "xrayhelper-chain"
+)
 
-var clashUrl []string
+var (
+	clashUrl []string
+	live     bool
+)
 
-type ClashSwitch struct{}
+type ClashSwitch struct {
+	// target the proxy group to switch, proxyTag if empty
+	target string
+}
 
 func (this *ClashSwitch) Execute(args []string) (bool, error) {
 	if confInfo, err := os.Stat(builds.Config.XrayHelper.CoreConfig); err != nil {
@@ -31,9 +45,14 @@ func (this *ClashSwitch) Execute(args []string) (bool, error) {
 	if len(args) > 1 {
 		return false, e.New("too many arguments").WithPrefix(tagClashswitch).WithPathObj(*this)
 	}
-	if len(args) == 1 {
-		_ = os.Remove(clashConfig)
-		if _, err := common.CopyFile(path.Join(builds.Config.XrayHelper.CoreConfig, args[0]), clashConfig); err != nil {
+	live = false
+	if len(args) == 1 && args[0] == "node" {
+		if err := this.selectNode(); err != nil {
+			return false, err
+		}
+		live = true
+	} else if len(args) == 1 {
+		if err := replaceConfig(path.Join(builds.Config.XrayHelper.CoreConfig, args[0]), clashConfig); err != nil {
 			return false, err
 		}
 	} else {
@@ -73,6 +92,53 @@ func (this *ClashSwitch) Set(_ bool, index int) error {
 	return change(index)
 }
 
+func (this *ClashSwitch) Group(bool, []int) error {
+	return e.New("mihomo does not support node group, use proxy-groups of your config instead").WithPrefix(tagClashswitch).WithPathObj(*this)
+}
+
+func (this *ClashSwitch) Chain(custom bool, index int, viaCustom bool, via int) error {
+	live = false
+	nodes, err := shareurls.LoadNodes(custom)
+	if err != nil {
+		return err
+	}
+	relays, err := shareurls.LoadNodes(viaCustom)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(nodes) || via < 0 || via >= len(relays) {
+		return e.New("invalid number").WithPrefix(tagClashswitch)
+	}
+	proxies, err := shareurls.ToOutbounds(&shareurls.Chain{Node: nodes[index], Relay: relays[via]}, "mihomo", this.chainName())
+	if err != nil {
+		return err
+	}
+	if err := this.addChainProxies(proxies); err != nil {
+		return err
+	}
+	if common.DryRun {
+		return nil
+	}
+	ctl, err := controller.Load()
+	if err != nil {
+		log.HandleDebug(err)
+		return nil
+	}
+	// the running mihomo should know the chain, otherwise it needs restart
+	if _, err := ctl.GetProxy(this.chainName()); err == nil {
+		live = ctl.SelectProxy(this.proxyGroup(), this.chainName()) == nil
+	}
+	return nil
+}
+
+func (this *ClashSwitch) Target(tag string) error {
+	if !common.IsProxyTag(tag) {
+		return e.New("proxy group " + tag + " is neither proxyTag nor one of proxyTags").WithPrefix(tagClashswitch)
+	}
+	this.target = tag
+	return nil
+}
+
 func (this *ClashSwitch) Choose(_ bool, index int) any {
 	loadClashUrl()
 	if index >= 0 && index < len(clashUrl) {
@@ -81,6 +147,21 @@ func (this *ClashSwitch) Choose(_ bool, index int) any {
 	return nil
 }
 
+func (this *ClashSwitch) Find(_ bool, match func(name string) bool) []int {
+	var result []int
+	loadClashUrl()
+	for index, url := range clashUrl {
+		if match(url) {
+			result = append(result, index)
+		}
+	}
+	return result
+}
+
+func (this *ClashSwitch) Live() bool {
+	return live
+}
+
 func (this *ClashSwitch) Clear() {
 	clashUrl = clashUrl[0:0]
 }
@@ -101,9 +182,145 @@ func change(index int) error {
 	if index < 0 || index >= len(builds.Config.XrayHelper.SubList) {
 		return e.New("invalid number").WithPrefix(tagClashswitch)
 	}
+	return replaceConfig(path.Join(builds.Config.XrayHelper.DataDir, "clashSub"+strconv.Itoa(index)+".yaml"), clashConfig)
+}
+
+// replaceConfig replace clash config with src
+func replaceConfig(src string, clashConfig string) error {
+	if common.DryRun {
+		srcByte, err := os.ReadFile(src)
+		if err != nil {
+			return e.New("read clash config failed, ", err).WithPrefix(tagClashswitch)
+		}
+		return common.WriteConfFile(clashConfig, srcByte)
+	}
 	_ = os.Remove(clashConfig)
-	if _, err := common.CopyFile(path.Join(builds.Config.XrayHelper.DataDir, "clashSub"+strconv.Itoa(index)+".yaml"), clashConfig); err != nil {
+	if _, err := common.CopyFile(src, clashConfig); err != nil {
 		return err
 	}
 	return nil
 }
+
+// proxyGroup the proxy group to switch, proxyTag unless another one of proxyTags is targeted
+func (this *ClashSwitch) proxyGroup() string {
+	if len(this.target) > 0 {
+		return this.target
+	}
+	return builds.Config.XrayHelper.ProxyTag
+}
+
+// chainName the proxy name of chain in the targeted proxy group
+func (this *ClashSwitch) chainName() string {
+	if this.proxyGroup() == builds.Config.XrayHelper.ProxyTag {
+		return chainProxy
+	}
+	return chainProxy + "-" + this.proxyGroup()
+}
+
+// addChainProxies put the chain proxies into config.yaml, and make the chain the first proxy of the targeted group
+func (this *ClashSwitch) addChainProxies(chainProxies []*serial.OrderedMap) error {
+	clashConfig := path.Join(builds.Config.XrayHelper.CoreConfig, "config.yaml")
+	configByte, err := common.ReadConfFile(clashConfig)
+	if err != nil {
+		return e.New("read clash config failed, ", err).WithPrefix(tagClashswitch)
+	}
+	var configMap serial.OrderedMap
+	if err := yaml.Unmarshal(configByte, &configMap); err != nil {
+		return e.New("unmarshal clash config failed, ", err).WithPrefix(tagClashswitch)
+	}
+	var proxyArray serial.OrderedArray
+	if proxies, ok := configMap.Get("proxies"); ok {
+		proxyArray, _ = proxies.Value.(serial.OrderedArray)
+	}
+	var keptProxies serial.OrderedArray
+	for _, proxy := range proxyArray {
+		if proxyMap, ok := proxy.(serial.OrderedMap); ok {
+			if name, ok := proxyMap.Get("name"); ok && (name.Value == this.chainName() || name.Value == shareurls.RelayTag(this.chainName())) {
+				continue
+			}
+		}
+		keptProxies = append(keptProxies, proxy)
+	}
+	for _, proxy := range chainProxies {
+		keptProxies = append(keptProxies, *proxy)
+	}
+	configMap.Set("proxies", keptProxies)
+	found := false
+	if groups, ok := configMap.Get("proxy-groups"); ok {
+		if groupArray, ok := groups.Value.(serial.OrderedArray); ok {
+			for i, group := range groupArray {
+				groupMap, ok := group.(serial.OrderedMap)
+				if !ok {
+					continue
+				}
+				if name, ok := groupMap.Get("name"); !ok || name.Value != this.proxyGroup() {
+					continue
+				}
+				members := serial.OrderedArray{this.chainName()}
+				if proxies, ok := groupMap.Get("proxies"); ok {
+					if proxyNames, ok := proxies.Value.(serial.OrderedArray); ok {
+						for _, proxyName := range proxyNames {
+							if proxyName != this.chainName() {
+								members = append(members, proxyName)
+							}
+						}
+					}
+				}
+				groupMap.Set("proxies", members)
+				groupArray[i] = groupMap
+				found = true
+			}
+			configMap.Set("proxy-groups", groupArray)
+		}
+	}
+	if !found {
+		return e.New("cannot find proxy group " + this.proxyGroup() + " from clash config").WithPrefix(tagClashswitch)
+	}
+	marshal, err := yaml.Marshal(configMap)
+	if err != nil {
+		return e.New("marshal clash config failed, ", err).WithPrefix(tagClashswitch)
+	}
+	return common.WriteConfFile(clashConfig, marshal)
+}
+
+// selectNode select a proxy node of the targeted selector group in running mihomo
+func (this *ClashSwitch) selectNode() error {
+	if common.DryRun {
+		return e.New("selecting node by controller does not change config, cannot dry run").WithPrefix(tagClashswitch)
+	}
+	ctl, err := controller.Load()
+	if err != nil {
+		return err
+	}
+	group, err := ctl.GetProxy(this.proxyGroup())
+	if err != nil {
+		return err
+	}
+	var nodes serial.OrderedArray
+	if all, ok := group.Get("all"); ok {
+		nodes, _ = all.Value.(serial.OrderedArray)
+	}
+	if len(nodes) == 0 {
+		return e.New("selector group " + this.proxyGroup() + " do not have any node").WithPrefix(tagClashswitch)
+	}
+	now := ""
+	if n, ok := group.Get("now"); ok {
+		now, _ = n.Value.(string)
+	}
+	for index, node := range nodes {
+		if node == now {
+			fmt.Printf(color.GreenString("[%d]")+" %v "+color.YellowString("(current)")+"\n", index, node)
+		} else {
+			fmt.Printf(color.GreenString("[%d]")+" %v\n", index, node)
+		}
+	}
+	fmt.Print("Please choose a node: ")
+	index := 0
+	if _, err := fmt.Scanln(&index); err != nil {
+		return e.New("invalid input, ", err).WithPrefix(tagClashswitch)
+	}
+	if index < 0 || index >= len(nodes) {
+		return e.New("invalid number").WithPrefix(tagClashswitch)
+	}
+	return ctl.SelectProxy(this.proxyGroup(), serial.ToString(nodes[index]))
+}
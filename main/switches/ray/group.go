@@ -0,0 +1,336 @@
+package ray
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/common"
+	e "XrayHelper/main/errors"
+	"XrayHelper/main/log"
+	"XrayHelper/main/serial"
+	"XrayHelper/main/shareurls"
+	"XrayHelper/main/states"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// groupPrefix the outbound tag prefix of group nodes, the xray balancer selects outbounds by this prefix
+const groupPrefix = "xrayhelpergroup"
+
+func (this *RaySwitch) Group(custom bool, indexes []int) error {
+	if err := loadShareUrl(custom); err != nil {
+		return err
+	}
+	return group(this.proxyTag(), indexes)
+}
+
+// groupTag get the outbound tag of group node
+func groupTag(index int) string {
+	return groupPrefix + "-" + strconv.Itoa(index)
+}
+
+// group generate the outbounds of nodes, and a balancer (xray) or urltest (sing-box) of them under proxy tag,
+// v2ray jsonv5 config is not supported
+func group(proxyTag string, indexes []int) error {
+	live = false
+	switch builds.Config.XrayHelper.CoreType {
+	case "xray", "sing-box":
+	default:
+		return e.New("node group is not supported by " + builds.Config.XrayHelper.CoreType).WithPrefix(tagRayswitch)
+	}
+	if proxyTag != builds.Config.XrayHelper.ProxyTag {
+		return e.New("node group can only be placed under proxyTag").WithPrefix(tagRayswitch)
+	}
+	if len(indexes) == 0 {
+		return e.New("no node in group").WithPrefix(tagRayswitch)
+	}
+	var members []int
+	exist := make(map[int]bool)
+	for _, index := range indexes {
+		if index < 0 || index >= len(shareUrls) {
+			return e.New("invalid number " + strconv.Itoa(index)).WithPrefix(tagRayswitch)
+		}
+		if !exist[index] {
+			exist[index] = true
+			members = append(members, index)
+		}
+	}
+	if builds.Config.XrayHelper.CoreType == "xray" {
+		var nodes []shareurls.ShareUrl
+		for _, index := range members {
+			nodes = append(nodes, shareUrls[index])
+		}
+		if err := common.HandleCoreConfDir(replaceXrayHost(append(nodes, pinnedNodes(proxyTag)...))); err != nil {
+			return err
+		}
+	}
+	selected := ""
+	replaceGroup := func(c []byte) (bool, []byte, error) {
+		var jsonMap serial.OrderedMap
+		if err := json.Unmarshal(c, &jsonMap); err != nil {
+			return false, nil, e.New("unmarshal config json failed, ", err).WithPrefix(tagRayswitch)
+		}
+		if _, ok := jsonMap.Get("outbounds"); !ok {
+			return false, nil, e.New("cannot found outbounds from provided conf").WithPrefix(tagRayswitch)
+		}
+		removeGroup(&jsonMap)
+		outbounds, _ := jsonMap.Get("outbounds")
+		outboundArray := outbounds.Value.(serial.OrderedArray)
+		proxy := -1
+		for i, outbound := range outboundArray {
+			if outboundMap, ok := outbound.(serial.OrderedMap); ok {
+				if tag, ok := outboundMap.Get("tag"); ok && tag.Value == builds.Config.XrayHelper.ProxyTag {
+					proxy = i
+					break
+				}
+			}
+		}
+		if proxy < 0 {
+			return false, nil, e.New("cannot found outbounds tag: " + builds.Config.XrayHelper.ProxyTag).WithPrefix(tagRayswitch)
+		}
+		var tags serial.OrderedArray
+		for _, index := range members {
+			outbound, err := shareUrls[index].ToOutboundWithTag(builds.Config.XrayHelper.CoreType, groupTag(index))
+			if err != nil {
+				return false, nil, err
+			}
+			outboundArray = append(outboundArray, *outbound)
+			tags = append(tags, groupTag(index))
+		}
+		if builds.Config.XrayHelper.CoreType == "sing-box" {
+			proxyMap := outboundArray[proxy].(serial.OrderedMap)
+			if outboundType, ok := proxyMap.Get("type"); ok && outboundType.Value == "selector" {
+				// sing-box selector, add the group into it rather than replace it
+				selected = groupPrefix
+				outboundArray = append(outboundArray, urltestOutbound(groupPrefix, tags))
+				addSelectorOutbound(&proxyMap, selected)
+				outboundArray[proxy] = proxyMap
+			} else {
+				outboundArray[proxy] = urltestOutbound(builds.Config.XrayHelper.ProxyTag, tags)
+			}
+		} else {
+			// the first node keeps the proxy outbound, used as the default outbound and the balancer fallback
+			outbound, err := shareUrls[members[0]].ToOutboundWithTag(builds.Config.XrayHelper.CoreType, builds.Config.XrayHelper.ProxyTag)
+			if err != nil {
+				return false, nil, err
+			}
+			outboundArray[proxy] = *outbound
+			addBalancer(&jsonMap)
+		}
+		jsonMap.Set("outbounds", outboundArray)
+		marshal, err := json.MarshalIndent(jsonMap, "", "    ")
+		if err != nil {
+			return false, nil, e.New("marshal config json failed, ", err).WithPrefix(tagRayswitch)
+		}
+		return true, marshal, nil
+	}
+	if err := common.HandleCoreConfDir(replaceGroup); err != nil {
+		return err
+	}
+	if common.DryRun {
+		return nil
+	}
+	saveGroup(members)
+	if len(selected) > 0 {
+		live = selectByController(proxyTag, selected)
+	}
+	return nil
+}
+
+// urltestOutbound the sing-box urltest outbound of group nodes
+func urltestOutbound(tag string, tags serial.OrderedArray) serial.OrderedMap {
+	var urltest serial.OrderedMap
+	urltest.Set("type", "urltest")
+	urltest.Set("tag", tag)
+	urltest.Set("outbounds", tags)
+	urltest.Set("url", builds.Config.Speedtest.Url)
+	urltest.Set("interval", builds.Config.Group.Interval)
+	urltest.Set("tolerance", builds.Config.Group.Tolerance)
+	return urltest
+}
+
+// addBalancer add the xray balancer under proxy tag, make the rules which route to proxy tag use it, and observe group nodes if needed
+func addBalancer(jsonMap *serial.OrderedMap) {
+	var routingMap serial.OrderedMap
+	if routing, ok := jsonMap.Get("routing"); ok {
+		routingMap, _ = routing.Value.(serial.OrderedMap)
+	}
+	var balancerArray serial.OrderedArray
+	if balancers, ok := routingMap.Get("balancers"); ok {
+		balancerArray, _ = balancers.Value.(serial.OrderedArray)
+	}
+	var balancer, strategy serial.OrderedMap
+	strategy.Set("type", builds.Config.Group.Strategy)
+	balancer.Set("tag", builds.Config.XrayHelper.ProxyTag)
+	balancer.Set("selector", serial.OrderedArray{groupPrefix + "-"})
+	balancer.Set("strategy", strategy)
+	balancer.Set("fallbackTag", builds.Config.XrayHelper.ProxyTag)
+	routingMap.Set("balancers", append(balancerArray, balancer))
+	if rules, ok := routingMap.Get("rules"); ok {
+		if ruleArray, ok := rules.Value.(serial.OrderedArray); ok {
+			for i, rule := range ruleArray {
+				if ruleMap, ok := rule.(serial.OrderedMap); ok {
+					if tag, ok := ruleMap.Get("outboundTag"); ok && tag.Value == builds.Config.XrayHelper.ProxyTag {
+						ruleMap.Delete("outboundTag")
+						ruleMap.Set("balancerTag", builds.Config.XrayHelper.ProxyTag)
+						ruleArray[i] = ruleMap
+					}
+				}
+			}
+			routingMap.Set("rules", ruleArray)
+		}
+	}
+	jsonMap.Set("routing", routingMap)
+	switch builds.Config.Group.Strategy {
+	case "leastPing", "leastLoad":
+		observatoryKey := "observatory"
+		if builds.Config.Group.Strategy == "leastLoad" {
+			observatoryKey = "burstObservatory"
+		}
+		var observatoryMap serial.OrderedMap
+		if observatory, ok := jsonMap.Get(observatoryKey); ok {
+			observatoryMap, _ = observatory.Value.(serial.OrderedMap)
+		}
+		var selectors serial.OrderedArray
+		if selector, ok := observatoryMap.Get("subjectSelector"); ok {
+			selectors, _ = selector.Value.(serial.OrderedArray)
+		}
+		observatoryMap.Set("subjectSelector", append(selectors, groupPrefix+"-"))
+		if observatoryKey == "observatory" {
+			if _, ok := observatoryMap.Get("probeUrl"); !ok {
+				observatoryMap.Set("probeUrl", builds.Config.Speedtest.Url)
+				observatoryMap.Set("probeInterval", builds.Config.Group.Interval)
+			}
+		} else if _, ok := observatoryMap.Get("pingConfig"); !ok {
+			var pingConfig serial.OrderedMap
+			pingConfig.Set("destination", builds.Config.Speedtest.Url)
+			pingConfig.Set("interval", builds.Config.Group.Interval)
+			observatoryMap.Set("pingConfig", pingConfig)
+		}
+		jsonMap.Set(observatoryKey, observatoryMap)
+	}
+}
+
+// removeGroup remove the generated group nodes, the group urltest and balancer, restore the rules which route to the balancer
+func removeGroup(jsonMap *serial.OrderedMap) {
+	if outbounds, ok := jsonMap.Get("outbounds"); ok {
+		if outboundArray, ok := outbounds.Value.(serial.OrderedArray); ok {
+			var kept serial.OrderedArray
+			for _, outbound := range outboundArray {
+				outboundMap, ok := outbound.(serial.OrderedMap)
+				if !ok {
+					kept = append(kept, outbound)
+					continue
+				}
+				if tag, ok := outboundMap.Get("tag"); ok {
+					if t, ok := tag.Value.(string); ok && strings.HasPrefix(t, groupPrefix) {
+						continue
+					}
+				}
+				// drop the group from sing-box selector
+				if outboundType, ok := outboundMap.Get("type"); ok && outboundType.Value == "selector" {
+					if members, ok := outboundMap.Get("outbounds"); ok {
+						if memberArray, ok := members.Value.(serial.OrderedArray); ok {
+							var keptMembers serial.OrderedArray
+							for _, member := range memberArray {
+								if member != groupPrefix {
+									keptMembers = append(keptMembers, member)
+								}
+							}
+							outboundMap.Set("outbounds", keptMembers)
+						}
+					}
+					if d, ok := outboundMap.Get("default"); ok && d.Value == groupPrefix {
+						outboundMap.Delete("default")
+					}
+				}
+				kept = append(kept, outboundMap)
+			}
+			jsonMap.Set("outbounds", kept)
+		}
+	}
+	if routing, ok := jsonMap.Get("routing"); ok {
+		if routingMap, ok := routing.Value.(serial.OrderedMap); ok {
+			removed := false
+			if balancers, ok := routingMap.Get("balancers"); ok {
+				if balancerArray, ok := balancers.Value.(serial.OrderedArray); ok {
+					var kept serial.OrderedArray
+					for _, balancer := range balancerArray {
+						if balancerMap, ok := balancer.(serial.OrderedMap); ok && isGroupSelector(balancerMap, "selector") {
+							removed = true
+							continue
+						}
+						kept = append(kept, balancer)
+					}
+					if len(kept) > 0 {
+						routingMap.Set("balancers", kept)
+					} else {
+						routingMap.Delete("balancers")
+					}
+				}
+			}
+			if rules, ok := routingMap.Get("rules"); ok && removed {
+				if ruleArray, ok := rules.Value.(serial.OrderedArray); ok {
+					for i, rule := range ruleArray {
+						if ruleMap, ok := rule.(serial.OrderedMap); ok {
+							if tag, ok := ruleMap.Get("balancerTag"); ok && tag.Value == builds.Config.XrayHelper.ProxyTag {
+								ruleMap.Delete("balancerTag")
+								ruleMap.Set("outboundTag", builds.Config.XrayHelper.ProxyTag)
+								ruleArray[i] = ruleMap
+							}
+						}
+					}
+					routingMap.Set("rules", ruleArray)
+				}
+			}
+			jsonMap.Set("routing", routingMap)
+		}
+	}
+	for _, observatoryKey := range []string{"observatory", "burstObservatory"} {
+		if observatory, ok := jsonMap.Get(observatoryKey); ok {
+			if observatoryMap, ok := observatory.Value.(serial.OrderedMap); ok && isGroupSelector(observatoryMap, "subjectSelector") {
+				var kept serial.OrderedArray
+				selectors, _ := observatoryMap.Get("subjectSelector")
+				for _, selector := range selectors.Value.(serial.OrderedArray) {
+					if selector != groupPrefix+"-" {
+						kept = append(kept, selector)
+					}
+				}
+				if len(kept) > 0 {
+					observatoryMap.Set("subjectSelector", kept)
+					jsonMap.Set(observatoryKey, observatoryMap)
+				} else {
+					jsonMap.Delete(observatoryKey)
+				}
+			}
+		}
+	}
+}
+
+// isGroupSelector whether the selector array of key contains the group prefix
+func isGroupSelector(m serial.OrderedMap, key string) bool {
+	if selectors, ok := m.Get(key); ok {
+		if selectorArray, ok := selectors.Value.(serial.OrderedArray); ok {
+			for _, selector := range selectorArray {
+				if selector == groupPrefix+"-" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// saveGroup persist the group nodes, so that the group can be regenerated after subscribe refreshed
+func saveGroup(members []int) {
+	if err := states.LoadSwitch(); err != nil {
+		log.HandleDebug(err)
+	}
+	states.Switch.Current = nil
+	states.Switch.Group = nil
+	for _, index := range members {
+		states.Switch.Group = append(states.Switch.Group, states.Node{Id: shareUrls[index].GetNodeInfo().Id, Custom: custom, Index: index})
+	}
+	if err := states.SaveSwitch(); err != nil {
+		log.HandleDebug(err)
+	}
+}
@@ -0,0 +1,58 @@
+package ray_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/switches/ray"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.json": `{"outbounds":[{"protocol":"freedom","tag":"proxy"},{"protocol":"freedom","tag":"direct"}],"dns":{},"routing":{"rules":[{"domain":["a.com"],"outboundTag":"proxy"}]}}`,
+		"sub.txt":     "trojan://pass@1.1.1.1:443#A\ntrojan://pass@2.2.2.2:443#B\n",
+	})
+	builds.Config.XrayHelper.CoreType = "xray"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	builds.Config.XrayHelper.ProxyTag = "proxy"
+	builds.Config.Group.Strategy = "leastPing"
+	s := new(ray.RaySwitch)
+	defer s.Clear()
+	if err := s.Group(false, []int{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	for _, want := range []string{`"tag": "xrayhelpergroup-0"`, `"tag": "xrayhelpergroup-1"`, `"balancerTag": "proxy"`, `"observatory"`} {
+		if !strings.Contains(string(result), want) {
+			t.Errorf("expect %s in config:\n%s", want, result)
+		}
+	}
+	if err := s.Set(false, 1); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	for _, unwanted := range []string{"xrayhelpergroup", "balancer", "observatory"} {
+		if strings.Contains(string(result), unwanted) {
+			t.Errorf("expect %s removed after switch:\n%s", unwanted, result)
+		}
+	}
+	if !strings.Contains(string(result), `"outboundTag": "proxy"`) {
+		t.Errorf("expect rule restored:\n%s", result)
+	}
+
+	// v2ray runs jsonv5 config, which has no xray balancer
+	v5 := `{"outbounds":[{"protocol":"freedom","tag":"proxy"},{"protocol":"freedom","tag":"direct"}],"router":{"rule":[{"domain":[{"type":"RootDomain","value":"a.com"}],"tag":"proxy"}]}}`
+	if err := os.WriteFile(builds.Config.XrayHelper.CoreConfig, []byte(v5), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builds.Config.XrayHelper.CoreType = "v2ray"
+	if err := s.Group(false, []int{0, 1}); err == nil || !strings.Contains(err.Error(), "not supported by v2ray") {
+		t.Errorf("expect group rejected by v2ray, got %v", err)
+	}
+	if result, _ = os.ReadFile(builds.Config.XrayHelper.CoreConfig); string(result) != v5 {
+		t.Errorf("expect v2ray config unchanged:\n%s", result)
+	}
+}
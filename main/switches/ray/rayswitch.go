@@ -3,25 +3,31 @@ package ray
 import (
 	"XrayHelper/main/builds"
 	"XrayHelper/main/common"
+	"XrayHelper/main/controller"
 	e "XrayHelper/main/errors"
 	"XrayHelper/main/log"
 	"XrayHelper/main/serial"
 	"XrayHelper/main/shareurls"
-	"bufio"
+	"XrayHelper/main/states"
 	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
 	"gopkg.in/yaml.v3"
-	"os"
-	"path"
-	"strings"
+	"strconv"
 )
 
 const tagRayswitch = "rayswitch"
 
-var shareUrls []shareurls.ShareUrl
+var (
+	shareUrls []shareurls.ShareUrl
+	custom    bool
+	live      bool
+)
 
-type RaySwitch struct{}
+type RaySwitch struct {
+	// target the outbound tag to switch, proxyTag if empty
+	target string
+}
 
 func (this *RaySwitch) Execute(args []string) (bool, error) {
 	if len(args) > 1 {
@@ -36,13 +42,13 @@ func (this *RaySwitch) Execute(args []string) (bool, error) {
 			return false, err
 		}
 	}
-	printProxyNode()
+	printProxyNode(this.proxyTag())
 	fmt.Print("Please choose a node: ")
 	index := 0
 	if _, err := fmt.Scanln(&index); err != nil {
 		return false, e.New("invalid input, ", err).WithPrefix(tagRayswitch).WithPathObj(*this)
 	}
-	if err := change(index); err != nil {
+	if err := change(this.proxyTag(), index, nil); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -62,11 +68,33 @@ func (this *RaySwitch) Get(custom bool) serial.OrderedArray {
 func (this *RaySwitch) Set(custom bool, index int) error {
 	err := loadShareUrl(custom)
 	if err == nil {
-		return change(index)
+		return change(this.proxyTag(), index, nil)
 	}
 	return err
 }
 
+func (this *RaySwitch) Chain(custom bool, index int, viaCustom bool, via int) error {
+	if err := loadShareUrl(custom); err != nil {
+		return err
+	}
+	relays, err := shareurls.LoadNodes(viaCustom)
+	if err != nil {
+		return err
+	}
+	if via < 0 || via >= len(relays) {
+		return e.New("invalid relay number").WithPrefix(tagRayswitch)
+	}
+	return change(this.proxyTag(), index, &relayNode{url: relays[via], node: states.Node{Id: relays[via].GetNodeInfo().Id, Custom: viaCustom, Index: via}})
+}
+
+func (this *RaySwitch) Target(tag string) error {
+	if !common.IsProxyTag(tag) {
+		return e.New("outbound tag " + tag + " is neither proxyTag nor one of proxyTags").WithPrefix(tagRayswitch)
+	}
+	this.target = tag
+	return nil
+}
+
 func (this *RaySwitch) Choose(custom bool, index int) any {
 	err := loadShareUrl(custom)
 	if err == nil {
@@ -77,43 +105,53 @@ func (this *RaySwitch) Choose(custom bool, index int) any {
 	return nil
 }
 
+func (this *RaySwitch) Find(custom bool, match func(name string) bool) []int {
+	var result []int
+	err := loadShareUrl(custom)
+	if err == nil {
+		for index, url := range shareUrls {
+			if match(url.GetNodeInfo().Remarks) {
+				result = append(result, index)
+			}
+		}
+	}
+	return result
+}
+
+func (this *RaySwitch) Live() bool {
+	return live
+}
+
 func (this *RaySwitch) Clear() {
 	shareUrls = shareUrls[0:0]
 }
 
-func change(index int) error {
+// relayNode the relay node of proxy chain
+type relayNode struct {
+	url  shareurls.ShareUrl
+	node states.Node
+}
+
+// chainTag get the outbound tag of chain, which is added into sing-box selector
+func chainTag(chain shareurls.ShareUrl) string {
+	return "xrayhelperchain-" + chain.GetNodeInfo().Id
+}
+
+// change replace the node of proxyTag by node of index, which dials through relay if it is not nil
+func change(proxyTag string, index int, relay *relayNode) error {
+	live = false
 	if index < 0 || index >= len(shareUrls) {
 		return e.New("invalid number").WithPrefix(tagRayswitch)
 	}
+	node := shareUrls[index]
+	hosts := []shareurls.ShareUrl{node}
+	if relay != nil {
+		node = &shareurls.Chain{Node: shareUrls[index], Relay: relay.url}
+		hosts = append(hosts, relay.url)
+	}
+	selected := ""
 	if builds.Config.XrayHelper.CoreType == "xray" {
-		replaceXrayHost := func(c []byte) (bool, []byte, error) {
-			// unmarshal
-			var jsonMap serial.OrderedMap
-			if err := json.Unmarshal(c, &jsonMap); err != nil {
-				return false, nil, e.New("unmarshal config json failed, ", err).WithPrefix(tagRayswitch)
-			}
-			// asset dns
-			if dns, ok := jsonMap.Get("dns"); ok {
-				dnsMap := dns.Value.(serial.OrderedMap)
-				// replace
-				var hostsMap serial.OrderedMap
-				nodeInfo := shareUrls[index].GetNodeInfo()
-				result, err := common.LookupIP(nodeInfo.Host)
-				if err == nil {
-					hostsMap.Set(nodeInfo.Host, result)
-					dnsMap.Set("hosts", hostsMap)
-				}
-				jsonMap.Set("dns", dnsMap)
-				// marshal
-				marshal, err := json.MarshalIndent(jsonMap, "", "    ")
-				if err != nil {
-					return false, nil, e.New("marshal config json failed, ", err).WithPrefix(tagRayswitch)
-				}
-				return true, marshal, nil
-			}
-			return false, nil, e.New("cannot find dns from your config").WithPrefix(tagRayswitch)
-		}
-		if err := common.HandleCoreConfDir(replaceXrayHost); err != nil {
+		if err := common.HandleCoreConfDir(replaceXrayHost(append(hosts, pinnedNodes(proxyTag)...))); err != nil {
 			return err
 		}
 	}
@@ -126,18 +164,45 @@ func change(index int) error {
 			if err != nil {
 				return false, nil, e.New("unmarshal config json failed, ", err).WithPrefix(tagRayswitch)
 			}
-			if outbounds, ok := jsonMap.Get("outbounds"); ok {
-				outboundArray := outbounds.Value.(serial.OrderedArray)
+			if _, ok := jsonMap.Get("outbounds"); ok {
+				// the group is placed under proxyTag only
+				if proxyTag == builds.Config.XrayHelper.ProxyTag {
+					removeGroup(&jsonMap)
+				}
+				outbounds, _ := jsonMap.Get("outbounds")
+				// the relay of last chain is not needed anymore
+				outboundArray := removeOutbound(outbounds.Value.(serial.OrderedArray), shareurls.RelayTag(proxyTag))
 				for i, outbound := range outboundArray {
 					outboundMap := outbound.(serial.OrderedMap)
 					if tag, ok := outboundMap.Get("tag"); ok {
-						if tag.Value == builds.Config.XrayHelper.ProxyTag {
-							// replace
-							outbound, err := shareUrls[index].ToOutboundWithTag(builds.Config.XrayHelper.CoreType, builds.Config.XrayHelper.ProxyTag)
-							if err != nil {
-								return false, nil, err
+						if tag.Value == proxyTag {
+							if outboundType, ok := outboundMap.Get("type"); ok && outboundType.Value == "selector" {
+								// sing-box selector, add node into it rather than replace it
+								selected = nodeTag(index)
+								if relay != nil {
+									selected = chainTag(node)
+								}
+								nodeOutbounds, err := shareurls.ToOutbounds(node, builds.Config.XrayHelper.CoreType, selected)
+								if err != nil {
+									return false, nil, err
+								}
+								outboundArray = setOutbound(outboundArray, nodeOutbounds[0], selected)
+								if len(nodeOutbounds) > 1 {
+									outboundArray = setOutbound(outboundArray, nodeOutbounds[1], shareurls.RelayTag(selected))
+								}
+								addSelectorOutbound(&outboundMap, selected)
+								outboundArray[i] = outboundMap
+							} else {
+								// replace
+								nodeOutbounds, err := shareurls.ToOutbounds(node, builds.Config.XrayHelper.CoreType, proxyTag)
+								if err != nil {
+									return false, nil, err
+								}
+								outboundArray[i] = nodeOutbounds[0]
+								for _, relayOutbound := range nodeOutbounds[1:] {
+									outboundArray = append(outboundArray, *relayOutbound)
+								}
 							}
-							outboundArray[i] = outbound
 							jsonMap.Set("outbounds", outboundArray)
 							// marshal
 							marshal, err := json.MarshalIndent(jsonMap, "", "    ")
@@ -148,7 +213,7 @@ func change(index int) error {
 						}
 					}
 				}
-				return false, nil, e.New("cannot found outbounds tag: " + builds.Config.XrayHelper.ProxyTag).WithPrefix(tagRayswitch)
+				return false, nil, e.New("cannot found outbounds tag: " + proxyTag).WithPrefix(tagRayswitch)
 			}
 			return false, nil, e.New("cannot found outbounds from provided conf").WithPrefix(tagRayswitch)
 		case "hysteria2":
@@ -159,7 +224,7 @@ func change(index int) error {
 				return false, nil, e.New("unmarshal config yaml failed, ", err).WithPrefix(tagRayswitch)
 			}
 			// get hysteria client config from shareUrl
-			clientObject, err := shareUrls[index].ToOutboundWithTag(builds.Config.XrayHelper.CoreType, "")
+			clientObject, err := node.ToOutboundWithTag(builds.Config.XrayHelper.CoreType, "")
 			if err != nil {
 				return false, nil, err
 			}
@@ -185,47 +250,256 @@ func change(index int) error {
 		}
 		return false, nil, e.New("unsupported core type " + builds.Config.XrayHelper.CoreType).WithPrefix(tagRayswitch)
 	}
-	return common.HandleCoreConfDir(replaceProxyNode)
+	if err := common.HandleCoreConfDir(replaceProxyNode); err != nil {
+		return err
+	}
+	if common.DryRun {
+		return nil
+	}
+	saveCurrent(proxyTag, index, selected, relay)
+	if len(selected) > 0 {
+		live = selectByController(proxyTag, selected)
+	}
+	return nil
 }
 
-func loadShareUrl(custom bool) error {
-	if len(shareUrls) > 0 {
+// replaceXrayHost get the handler which puts the resolved ip of nodes into xray dns hosts
+func replaceXrayHost(nodes []shareurls.ShareUrl) func(c []byte) (bool, []byte, error) {
+	return func(c []byte) (bool, []byte, error) {
+		// unmarshal
+		var jsonMap serial.OrderedMap
+		if err := json.Unmarshal(c, &jsonMap); err != nil {
+			return false, nil, e.New("unmarshal config json failed, ", err).WithPrefix(tagRayswitch)
+		}
+		// asset dns
+		if dns, ok := jsonMap.Get("dns"); ok {
+			dnsMap := dns.Value.(serial.OrderedMap)
+			// replace
+			var hostsMap serial.OrderedMap
+			resolved := false
+			for _, node := range nodes {
+				nodeInfo := node.GetNodeInfo()
+				result, err := common.LookupIP(nodeInfo.Host)
+				if err == nil {
+					hostsMap.Set(nodeInfo.Host, result)
+					resolved = true
+				}
+			}
+			if resolved {
+				dnsMap.Set("hosts", hostsMap)
+			}
+			jsonMap.Set("dns", dnsMap)
+			// marshal
+			marshal, err := json.MarshalIndent(jsonMap, "", "    ")
+			if err != nil {
+				return false, nil, e.New("marshal config json failed, ", err).WithPrefix(tagRayswitch)
+			}
+			return true, marshal, nil
+		}
+		return false, nil, e.New("cannot find dns from your config").WithPrefix(tagRayswitch)
+	}
+}
+
+// saveCurrent persist the current node of proxyTag, so that it can be re-resolved after subscribe refreshed
+func saveCurrent(proxyTag string, index int, selected string, relay *relayNode) {
+	if err := states.LoadSwitch(); err != nil {
+		log.HandleDebug(err)
+	}
+	node := states.Node{Id: shareUrls[index].GetNodeInfo().Id, Custom: custom, Index: index}
+	if relay != nil {
+		node.Via = &relay.node
+	}
+	if proxyTag == builds.Config.XrayHelper.ProxyTag {
+		states.Switch.Current = &node
+		states.Switch.Group = nil
+	} else {
+		states.Switch.Tags[proxyTag] = node
+	}
+	if relay == nil && len(selected) > 0 {
+		states.Switch.Routes[selected] = node
+	}
+	if err := states.SaveSwitch(); err != nil {
+		log.HandleDebug(err)
+	}
+}
+
+// proxyTag the outbound tag to switch, proxyTag unless another one of proxyTags is targeted
+func (this *RaySwitch) proxyTag() string {
+	if len(this.target) > 0 {
+		return this.target
+	}
+	return builds.Config.XrayHelper.ProxyTag
+}
+
+// pinnedNodes the current nodes of the switchable tags other than proxyTag, their hosts should stay in xray dns hosts
+func pinnedNodes(proxyTag string) []shareurls.ShareUrl {
+	if err := states.LoadSwitch(); err != nil {
+		log.HandleDebug(err)
 		return nil
 	}
-	var nodeTxt string
+	var nodes []states.Node
+	if proxyTag != builds.Config.XrayHelper.ProxyTag {
+		if states.Switch.Current != nil {
+			nodes = append(nodes, *states.Switch.Current)
+		}
+		nodes = append(nodes, states.Switch.Group...)
+	}
+	for tag, node := range states.Switch.Tags {
+		if tag != proxyTag && common.IsProxyTag(tag) {
+			nodes = append(nodes, node)
+		}
+	}
+	var (
+		pinned []shareurls.ShareUrl
+		pin    func(node states.Node)
+	)
+	loaded := make(map[bool][]shareurls.ShareUrl)
+	pin = func(node states.Node) {
+		urls, ok := loaded[node.Custom]
+		if !ok {
+			urls, _ = shareurls.LoadNodes(node.Custom)
+			loaded[node.Custom] = urls
+		}
+		// the node may be gone with subscribe refreshed
+		if node.Index >= 0 && node.Index < len(urls) && urls[node.Index].GetNodeInfo().Id == node.Id {
+			pinned = append(pinned, urls[node.Index])
+		}
+		if node.Via != nil {
+			pin(*node.Via)
+		}
+	}
+	for _, node := range nodes {
+		pin(node)
+	}
+	return pinned
+}
+
+// nodeTag get the outbound tag of node, same as the tag used by routes
+func nodeTag(index int) string {
 	if custom {
-		nodeTxt = path.Join(builds.Config.XrayHelper.DataDir, "custom.txt")
-	} else {
-		nodeTxt = path.Join(builds.Config.XrayHelper.DataDir, "sub.txt")
+		return "xrayhelpercustom-" + strconv.Itoa(index)
 	}
-	subFile, err := os.Open(nodeTxt)
-	if err != nil {
-		return e.New("open proxy node file failed, ", err).WithPrefix(tagRayswitch)
-	}
-	defer func(subFile *os.File) {
-		_ = subFile.Close()
-	}(subFile)
-	subScanner := bufio.NewScanner(subFile)
-	subScanner.Split(bufio.ScanLines)
-	for subScanner.Scan() {
-		url := strings.TrimSpace(subScanner.Text())
-		if len(url) > 0 {
-			shareUrl, err := shareurls.Parse(url)
-			if err != nil {
-				log.HandleDebug("switch: " + err.Error() + ", drop it")
-				continue
+	return "xrayhelper-" + strconv.Itoa(index)
+}
+
+// removeOutbound remove the outbound which has the tag
+func removeOutbound(outboundArray serial.OrderedArray, tag string) serial.OrderedArray {
+	for i, o := range outboundArray {
+		if outboundMap, ok := o.(serial.OrderedMap); ok {
+			if t, ok := outboundMap.Get("tag"); ok && t.Value == tag {
+				return append(outboundArray[:i], outboundArray[i+1:]...)
 			}
-			shareUrls = append(shareUrls, shareUrl)
 		}
 	}
-	if len(shareUrls) == 0 {
-		return e.New("no valid nodes").WithPrefix(tagRayswitch)
+	return outboundArray
+}
+
+// setOutbound replace the outbound which has the same tag, or append it
+func setOutbound(outboundArray serial.OrderedArray, outbound *serial.OrderedMap, tag string) serial.OrderedArray {
+	for i, o := range outboundArray {
+		if outboundMap, ok := o.(serial.OrderedMap); ok {
+			if t, ok := outboundMap.Get("tag"); ok && t.Value == tag {
+				outboundArray[i] = *outbound
+				return outboundArray
+			}
+		}
 	}
+	return append(outboundArray, *outbound)
+}
+
+// addSelectorOutbound add tag into sing-box selector outbounds, and make it default
+func addSelectorOutbound(selector *serial.OrderedMap, tag string) {
+	var outbounds serial.OrderedArray
+	if o, ok := selector.Get("outbounds"); ok {
+		outbounds, _ = o.Value.(serial.OrderedArray)
+	}
+	exist := false
+	for _, o := range outbounds {
+		if o == tag {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		outbounds = append(outbounds, tag)
+	}
+	selector.Set("outbounds", outbounds)
+	selector.Set("default", tag)
+}
+
+// selectByController select the node of proxyTag selector by core controller, return true if the running core has been switched
+func selectByController(proxyTag string, tag string) bool {
+	ctl, err := controller.Load()
+	if err != nil {
+		log.HandleDebug(err)
+		return false
+	}
+	// the running core should know the node, otherwise it needs restart
+	if _, err := ctl.GetProxy(tag); err != nil {
+		log.HandleDebug(err)
+		return false
+	}
+	if err := ctl.SelectProxy(proxyTag, tag); err != nil {
+		log.HandleDebug(err)
+		return false
+	}
+	return true
+}
+
+func loadShareUrl(isCustom bool) error {
+	if len(shareUrls) > 0 {
+		return nil
+	}
+	custom = isCustom
+	nodes, err := shareurls.LoadNodes(isCustom)
+	if err != nil {
+		return err
+	}
+	shareUrls = nodes
 	return nil
 }
 
-func printProxyNode() {
-	for index, shareUrl := range shareUrls {
-		fmt.Printf(color.GreenString("[%d]")+" %s\n", index, shareUrl.GetNodeInfoStr())
+func printProxyNode(proxyTag string) {
+	current := -1
+	grouped := make(map[int]bool)
+	if err := states.LoadSwitch(); err == nil {
+		if proxyTag != builds.Config.XrayHelper.ProxyTag {
+			if node, ok := states.Switch.Tags[proxyTag]; ok && node.Custom == custom {
+				current = node.Index
+			}
+		} else if states.Switch.Current != nil && states.Switch.Current.Custom == custom {
+			current = states.Switch.Current.Index
+		}
+		for _, node := range states.Switch.Group {
+			if node.Custom == custom {
+				grouped[node.Index] = true
+			}
+		}
+	}
+	if err := states.LoadSpeedtest(); err != nil {
+		log.HandleDebug(err)
+	}
+	var ids []string
+	for _, shareUrl := range shareUrls {
+		ids = append(ids, shareUrl.GetNodeInfo().Id)
+	}
+	for _, index := range states.Order(ids, builds.Config.Speedtest.Sort, builds.Config.Speedtest.HideFailed) {
+		line := color.GreenString("[%d]", index) + " " + shareUrls[index].GetNodeInfoStr()
+		if latest := states.Latest(ids[index]); latest != nil {
+			if latest.Realping >= 0 {
+				line += " " + color.CyanString("%dms", latest.Realping)
+			} else {
+				line += " " + color.RedString("failed")
+			}
+		}
+		if located := states.Located(ids[index]); located != nil && len(located.Country) > 0 {
+			line += " " + color.MagentaString("[%s]", located.Country)
+		}
+		if index == current {
+			line += " " + color.YellowString("(current)")
+		} else if grouped[index] {
+			line += " " + color.YellowString("(group)")
+		}
+		fmt.Println(line)
 	}
 }
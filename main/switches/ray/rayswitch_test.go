@@ -0,0 +1,60 @@
+package ray_test
+
+import (
+	"XrayHelper/main/builds"
+	"XrayHelper/main/builds/buildstest"
+	"XrayHelper/main/states"
+	"XrayHelper/main/switches/ray"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	dir := buildstest.Setup(t, map[string]string{
+		"config.json": `{"dns":{"servers":["1.1.1.1"]},"outbounds":[{"protocol":"freedom","tag":"proxy"},{"protocol":"freedom","tag":"proxy-us"}]}`,
+		"sub.txt":     "trojan://pass@127.0.0.1:443#A\ntrojan://pass@127.0.0.2:443#B\n",
+	})
+	builds.Config.XrayHelper.CoreType = "xray"
+	builds.Config.XrayHelper.CoreConfig = path.Join(dir, "config.json")
+	builds.Config.XrayHelper.ProxyTag = "proxy"
+	builds.Config.XrayHelper.ProxyTags = []string{"proxy-us"}
+	s := new(ray.RaySwitch)
+	defer s.Clear()
+	if err := s.Target("proxy-jp"); err == nil {
+		t.Error("expect proxy-jp not switchable")
+	}
+	if err := s.Set(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Target("proxy-us"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(false, 1); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := os.ReadFile(builds.Config.XrayHelper.CoreConfig)
+	for _, want := range []string{`"address": "127.0.0.1"`, `"address": "127.0.0.2"`, `"127.0.0.1": [`, `"127.0.0.2": [`} {
+		if !strings.Contains(string(result), want) {
+			t.Errorf("expect %s in config:\n%s", want, result)
+		}
+	}
+	if err := states.LoadSwitch(); err != nil {
+		t.Fatal(err)
+	}
+	if states.Switch.Current == nil || states.Switch.Current.Index != 0 || states.Switch.Tags["proxy-us"].Index != 1 {
+		t.Errorf("unexpected switch state %+v", states.Switch)
+	}
+	// a new switch does not inherit the target
+	other := new(ray.RaySwitch)
+	if err := other.Set(false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := states.LoadSwitch(); err != nil {
+		t.Fatal(err)
+	}
+	if states.Switch.Current == nil || states.Switch.Current.Index != 1 || states.Switch.Tags["proxy-us"].Index != 1 {
+		t.Errorf("expect proxy switched by new switch, got %+v", states.Switch)
+	}
+}
@@ -12,9 +12,14 @@ const tagSwitches = "switches"
 // Switch implement this interface, that program can deal different core config switch
 type Switch interface {
 	Execute(args []string) (bool, error)
+	Target(tag string) error
 	Get(custom bool) serial.OrderedArray
 	Set(custom bool, index int) error
+	Group(custom bool, indexes []int) error
+	Chain(custom bool, index int, viaCustom bool, via int) error
 	Choose(custom bool, index int) any
+	Find(custom bool, match func(name string) bool) []int
+	Live() bool
 	Clear()
 }
 